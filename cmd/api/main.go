@@ -14,12 +14,21 @@ import (
 	"github.com/go-chi/chi/v5"
 	chimiddleware "github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
+	"stringmeup/backend/internal/admin"
 	"stringmeup/backend/internal/auth"
+	"stringmeup/backend/internal/billing"
 	"stringmeup/backend/internal/config"
+	"stringmeup/backend/internal/dataexport"
 	"stringmeup/backend/internal/db"
+	"stringmeup/backend/internal/i18n"
+	"stringmeup/backend/internal/mail"
 	"stringmeup/backend/internal/middleware"
+	"stringmeup/backend/internal/notifications"
+	"stringmeup/backend/internal/profiles"
 	"stringmeup/backend/internal/progress"
 	"stringmeup/backend/internal/projects"
+	"stringmeup/backend/internal/signing"
+	"stringmeup/backend/internal/storage"
 	"stringmeup/backend/internal/uploads"
 	"stringmeup/backend/internal/users"
 )
@@ -38,25 +47,57 @@ func main() {
 		log.Fatalf("db migrate: %v", err)
 	}
 
+	// Background jobs stop when the server shuts down
+	bgCtx, stopBG := context.WithCancel(context.Background())
+	defer stopBG()
+
+	// ── Signing keys ──────────────────────────────────────────────────────────
+	keys, err := signing.NewKeyring(bgCtx, pool, cfg)
+	if err != nil {
+		log.Fatalf("signing keys: %v", err)
+	}
+	go keys.Run(bgCtx)
+
 	// ── Services ──────────────────────────────────────────────────────────────
-	authSvc := auth.NewService(pool, cfg)
-	userSvc := users.NewService(pool)
-	projectSvc := projects.NewService(pool)
+	mailer := mail.New(cfg)
+	notifySvc := notifications.NewService(pool)
+	go notifySvc.Run(bgCtx)
+	authSvc := auth.NewService(pool, cfg, keys, mailer, notifySvc)
+	go authSvc.Run(bgCtx)
+	var billingProviders []billing.Provider
+	if cfg.BillingFakeSecret != "" {
+		billingProviders = append(billingProviders, billing.NewFakeProvider(cfg.BillingFakeSecret))
+	}
+	billingSvc := billing.NewService(pool, cfg, billingProviders...)
+	store, err := storage.New(cfg)
+	if err != nil {
+		log.Fatalf("storage: %v", err)
+	}
+	uploadSvc := uploads.NewService(pool, cfg, store, billingSvc)
+	go uploadSvc.Run(bgCtx)
+	go uploadSvc.RunGC(bgCtx)
+	userSvc := users.NewService(pool, cfg, uploadSvc, mailer, notifySvc)
+	go userSvc.RunDeletions(bgCtx)
+	projectSvc := projects.NewService(pool, userSvc, billingSvc, uploadSvc)
 	progressSvc := progress.NewService(pool)
-	uploadSvc := uploads.NewService(cfg)
+	exportSvc := dataexport.NewService(pool, userSvc, projectSvc, progressSvc, uploadSvc, mailer, notifySvc)
+	go exportSvc.Run(bgCtx)
+	profileSvc := profiles.NewService(pool, userSvc, uploadSvc)
+	adminSvc := admin.NewService(pool, authSvc, projectSvc, uploadSvc)
 
 	// ── Router ────────────────────────────────────────────────────────────────
 	r := chi.NewRouter()
 
 	r.Use(chimiddleware.RequestID)
-	r.Use(chimiddleware.RealIP)
+	r.Use(middleware.RealIP(cfg.TrustedProxies))
 	r.Use(chimiddleware.Logger)
 	r.Use(chimiddleware.Recoverer)
 	r.Use(chimiddleware.Timeout(60 * time.Second))
+	r.Use(i18n.Middleware)
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"*"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "Upload-Offset"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: false,
 		MaxAge:           300,
@@ -66,17 +107,29 @@ func main() {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte(`{"status":"ok"}`))
 	})
+	r.Get("/.well-known/jwks.json", signing.HandleJWKS(keys))
+	if local, ok := store.(*storage.Local); ok {
+		storage.RegisterRoutes(r, local)
+	}
 
 	r.Route("/v1", func(r chi.Router) {
 		// Public
 		auth.RegisterRoutes(r, authSvc)
+		users.RegisterPublicRoutes(r, userSvc)
+		billing.RegisterWebhookRoutes(r, billingSvc)
+		profiles.RegisterRoutes(r, profileSvc)
 
 		// Protected
 		r.Group(func(r chi.Router) {
-			r.Use(middleware.Authenticate(cfg.JWTSecret))
+			r.Use(middleware.Authenticate(keys, authSvc.VerifyPAT, authSvc.Account))
+			r.Use(i18n.Prefer(middleware.Locale))
 			users.RegisterRoutes(r, userSvc)
+			dataexport.RegisterRoutes(r, exportSvc)
 			projects.RegisterRoutes(r, projectSvc, progressSvc)
 			uploads.RegisterRoutes(r, uploadSvc)
+			billing.RegisterRoutes(r, billingSvc)
+			notifications.RegisterRoutes(r, notifySvc)
+			admin.RegisterRoutes(r, adminSvc)
 		})
 	})
 
@@ -102,6 +155,7 @@ func main() {
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
+	stopBG()
 	srv.Shutdown(ctx)
 	log.Println("server stopped")
 }
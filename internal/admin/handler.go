@@ -0,0 +1,234 @@
+// internal/admin/handler.go
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"stringmeup/backend/internal/db"
+	"stringmeup/backend/internal/middleware"
+)
+
+// RegisterRoutes mounts the admin API. Personal access tokens never reach
+// it, whatever their scopes.
+func RegisterRoutes(r chi.Router, svc *Service) {
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(middleware.RequireSession)
+		r.Use(middleware.RequireRole(middleware.RoleAdmin))
+
+		r.Get("/stats", handleStats(svc))
+		r.Get("/audit", handleAuditLog(svc))
+		r.Get("/storage/gc", handleGCRuns(svc))
+		r.Post("/storage/gc", handleCollectGarbage(svc))
+		r.Post("/storage/recompute", handleRecomputeStorage(svc, false))
+		r.Get("/users", handleListUsers(svc))
+		r.Route("/users/{id}", func(r chi.Router) {
+			r.Get("/", handleGetUser(svc))
+			r.Post("/disable", handleSetDisabled(svc, true))
+			r.Post("/enable", handleSetDisabled(svc, false))
+			r.Post("/logout", handleForceLogout(svc))
+			r.Post("/unlock", handleUnlock(svc))
+			r.Post("/role", handleSetRole(svc))
+			r.Post("/storage/recompute", handleRecomputeStorage(svc, true))
+			r.Get("/projects", handleListProjects(svc))
+			r.Get("/projects/{projectID}", handleGetProject(svc))
+		})
+	})
+}
+
+func pagination(r *http.Request) (page, limit int) {
+	page, _ = strconv.Atoi(r.URL.Query().Get("page"))
+	limit, _ = strconv.Atoi(r.URL.Query().Get("limit"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	return page, limit
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrUserNotFound):
+		db.Error(w, http.StatusNotFound, "NOT_FOUND", err.Error())
+	case errors.Is(err, ErrSelfAction):
+		db.Error(w, http.StatusConflict, "SELF_ACTION", err.Error())
+	case errors.Is(err, ErrInvalidRole):
+		db.Error(w, http.StatusBadRequest, "VALIDATION_ERROR", err.Error())
+	default:
+		db.Error(w, http.StatusInternalServerError, "SERVER_ERROR", err.Error())
+	}
+}
+
+func handleStats(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		st, err := svc.Stats(r.Context(), middleware.UserID(r))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		db.Data(w, http.StatusOK, st)
+	}
+}
+
+func handleAuditLog(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, limit := pagination(r)
+		entries, err := svc.AuditLog(r.Context(), r.URL.Query().Get("user_id"), page, limit)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		db.Data(w, http.StatusOK, entries)
+	}
+}
+
+func handleListUsers(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, limit := pagination(r)
+		list, meta, err := svc.ListUsers(r.Context(), middleware.UserID(r), r.URL.Query().Get("q"), page, limit)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		db.JSON(w, http.StatusOK, map[string]any{"data": list, "meta": meta})
+	}
+}
+
+func handleGetUser(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, lockouts, err := svc.GetUser(r.Context(), middleware.UserID(r), chi.URLParam(r, "id"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		db.Data(w, http.StatusOK, map[string]any{"user": u, "lockouts": lockouts})
+	}
+}
+
+func handleSetDisabled(svc *Service, disabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Reason string `json:"reason"`
+		}
+		// The reason is optional, so an empty body is fine
+		json.NewDecoder(r.Body).Decode(&body)
+
+		err := svc.SetDisabled(r.Context(), middleware.UserID(r), chi.URLParam(r, "id"), disabled, body.Reason)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func handleForceLogout(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := svc.ForceLogout(r.Context(), middleware.UserID(r), chi.URLParam(r, "id")); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func handleUnlock(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := svc.Unlock(r.Context(), middleware.UserID(r), chi.URLParam(r, "id")); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func handleSetRole(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Role string `json:"role"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			db.Error(w, http.StatusBadRequest, "VALIDATION_ERROR", "invalid body")
+			return
+		}
+		if err := svc.SetRole(r.Context(), middleware.UserID(r), chi.URLParam(r, "id"), body.Role); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func handleListProjects(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, limit := pagination(r)
+		list, meta, err := svc.ListProjects(r.Context(), middleware.UserID(r), chi.URLParam(r, "id"), page, limit)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		db.JSON(w, http.StatusOK, map[string]any{"data": list, "meta": meta})
+	}
+}
+
+func handleGetProject(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, err := svc.GetProject(r.Context(), middleware.UserID(r),
+			chi.URLParam(r, "id"), chi.URLParam(r, "projectID"))
+		if err != nil {
+			db.Error(w, http.StatusNotFound, "NOT_FOUND", "project not found")
+			return
+		}
+		db.Data(w, http.StatusOK, p)
+	}
+}
+
+func handleGCRuns(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, limit := pagination(r)
+		runs, err := svc.GCRuns(r.Context(), limit)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		db.Data(w, http.StatusOK, runs)
+	}
+}
+
+func handleCollectGarbage(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			DryRun *bool `json:"dry_run"`
+		}
+		// An empty body is a dry run; deleting has to be asked for
+		json.NewDecoder(r.Body).Decode(&body)
+		dryRun := body.DryRun == nil || *body.DryRun
+
+		report, err := svc.CollectGarbage(r.Context(), middleware.UserID(r), dryRun)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		db.Data(w, http.StatusOK, report)
+	}
+}
+
+func handleRecomputeStorage(svc *Service, oneUser bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var userID string
+		if oneUser {
+			userID = chi.URLParam(r, "id")
+		}
+		changed, err := svc.RecomputeStorage(r.Context(), middleware.UserID(r), userID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		db.Data(w, http.StatusOK, changed)
+	}
+}
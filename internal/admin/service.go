@@ -0,0 +1,378 @@
+// internal/admin/service.go
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"stringmeup/backend/internal/auth"
+	"stringmeup/backend/internal/middleware"
+	"stringmeup/backend/internal/projects"
+	"stringmeup/backend/internal/uploads"
+)
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrSelfAction   = errors.New("admins can't do that to their own account")
+	ErrInvalidRole  = errors.New("role must be user or admin")
+)
+
+type User struct {
+	ID                  string     `json:"id"`
+	Email               string     `json:"email"`
+	Name                string     `json:"name"`
+	Role                string     `json:"role"`
+	TOTPEnabled         bool       `json:"totp_enabled"`
+	DisabledAt          *time.Time `json:"disabled_at"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at"`
+	ProjectCount        int        `json:"project_count"`
+	CreatedAt           time.Time  `json:"created_at"`
+}
+
+type ListMeta struct {
+	Total int `json:"total"`
+	Page  int `json:"page"`
+	Limit int `json:"limit"`
+}
+
+type Stats struct {
+	Users            int `json:"users"`
+	DisabledUsers    int `json:"disabled_users"`
+	PendingDeletions int `json:"pending_deletions"`
+	NewUsers7d       int `json:"new_users_7d"`
+	Projects         int `json:"projects"`
+	ActiveProjects7d int `json:"active_projects_7d"`
+	ActiveLockouts   int `json:"active_lockouts"`
+}
+
+type AuditEntry struct {
+	ID           string         `json:"id"`
+	AdminID      *string        `json:"admin_id"`
+	Action       string         `json:"action"`
+	TargetUserID *string        `json:"target_user_id"`
+	Details      map[string]any `json:"details"`
+	CreatedAt    time.Time      `json:"created_at"`
+}
+
+type Service struct {
+	db       *pgxpool.Pool
+	auth     *auth.Service
+	projects *projects.Service
+	uploads  *uploads.Service
+}
+
+func NewService(db *pgxpool.Pool, auth *auth.Service, projects *projects.Service, uploads *uploads.Service) *Service {
+	return &Service{db: db, auth: auth, projects: projects, uploads: uploads}
+}
+
+// audit records an admin action. Actions are recorded even when they only
+// read data, since viewing a user's projects is itself worth tracing.
+func (s *Service) audit(ctx context.Context, adminID, action, targetUserID string, details map[string]any) error {
+	return insertAudit(ctx, s.db, adminID, action, targetUserID, details)
+}
+
+// execer is a pool or a transaction.
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// insertAudit records an admin action through q. Actions that change data
+// pass their transaction, so the change and its audit entry commit
+// together or not at all.
+func insertAudit(ctx context.Context, q execer, adminID, action, targetUserID string, details map[string]any) error {
+	if details == nil {
+		details = map[string]any{}
+	}
+	var target *string
+	if targetUserID != "" {
+		target = &targetUserID
+	}
+	_, err := q.Exec(ctx,
+		`INSERT INTO admin_audit_log (admin_id, action, target_user_id, details)
+		 VALUES ($1, $2, $3, $4)`, adminID, action, target, details)
+	if err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	return nil
+}
+
+const userColumns = `u.id, u.email, u.name, u.role, u.totp_enabled, u.disabled_at,
+	u.deletion_scheduled_at,
+	(SELECT COUNT(*) FROM projects p WHERE p.user_id = u.id),
+	u.created_at`
+
+// ListUsers searches users by email or name, newest first.
+func (s *Service) ListUsers(ctx context.Context, adminID, query string, page, limit int) ([]User, ListMeta, error) {
+	if err := s.audit(ctx, adminID, "users.list", "", map[string]any{"q": query, "page": page}); err != nil {
+		return nil, ListMeta{}, err
+	}
+
+	pattern := "%" + query + "%"
+	var total int
+	s.db.QueryRow(ctx,
+		`SELECT COUNT(*) FROM users WHERE email ILIKE $1 OR name ILIKE $1`, pattern).Scan(&total)
+
+	rows, err := s.db.Query(ctx,
+		`SELECT `+userColumns+`
+		 FROM users u WHERE u.email ILIKE $1 OR u.name ILIKE $1
+		 ORDER BY u.created_at DESC LIMIT $2 OFFSET $3`,
+		pattern, limit, (page-1)*limit)
+	if err != nil {
+		return nil, ListMeta{}, err
+	}
+	defer rows.Close()
+
+	list := []User{}
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Email, &u.Name, &u.Role, &u.TOTPEnabled,
+			&u.DisabledAt, &u.DeletionScheduledAt, &u.ProjectCount, &u.CreatedAt); err != nil {
+			return nil, ListMeta{}, err
+		}
+		list = append(list, u)
+	}
+	return list, ListMeta{Total: total, Page: page, Limit: limit}, rows.Err()
+}
+
+// GetUser returns a user with their login lockout history.
+func (s *Service) GetUser(ctx context.Context, adminID, userID string) (*User, []auth.LoginLockout, error) {
+	if err := s.audit(ctx, adminID, "users.view", userID, nil); err != nil {
+		return nil, nil, err
+	}
+	u := &User{}
+	err := s.db.QueryRow(ctx,
+		`SELECT `+userColumns+` FROM users u WHERE u.id = $1`, userID,
+	).Scan(&u.ID, &u.Email, &u.Name, &u.Role, &u.TOTPEnabled,
+		&u.DisabledAt, &u.DeletionScheduledAt, &u.ProjectCount, &u.CreatedAt)
+	if err != nil {
+		return nil, nil, ErrUserNotFound
+	}
+	lockouts, err := s.auth.Lockouts(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return u, lockouts, nil
+}
+
+// SetDisabled disables or re-enables an account. Disabling also ends every
+// session, since Authenticate rejects disabled users on each request.
+func (s *Service) SetDisabled(ctx context.Context, adminID, userID string, disabled bool, reason string) error {
+	if adminID == userID {
+		return ErrSelfAction
+	}
+	action := "users.enable"
+	query := `UPDATE users SET disabled_at = NULL WHERE id = $1`
+	if disabled {
+		action = "users.disable"
+		query = `UPDATE users SET disabled_at = NOW() WHERE id = $1`
+	}
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	if disabled {
+		if err := forceLogout(ctx, tx, userID); err != nil {
+			return err
+		}
+		if err := insertAudit(ctx, tx, adminID, "users.force_logout", userID, nil); err != nil {
+			return err
+		}
+	}
+	if err := insertAudit(ctx, tx, adminID, action, userID, map[string]any{"reason": reason}); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// ForceLogout revokes all refresh tokens and invalidates access tokens
+// issued so far. Personal access tokens are left alone; they aren't
+// sessions.
+func (s *Service) ForceLogout(ctx context.Context, adminID, userID string) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := forceLogout(ctx, tx, userID); err != nil {
+		return err
+	}
+	if err := insertAudit(ctx, tx, adminID, "users.force_logout", userID, nil); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func forceLogout(ctx context.Context, tx pgx.Tx, userID string) error {
+	tag, err := tx.Exec(ctx, `UPDATE users SET sessions_revoked_at = NOW(), sessions_kept_id = NULL WHERE id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	_, err = tx.Exec(ctx, `DELETE FROM refresh_tokens WHERE user_id = $1`, userID)
+	return err
+}
+
+func (s *Service) Unlock(ctx context.Context, adminID, userID string) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := s.auth.Unlock(ctx, tx, userID, adminID); err != nil {
+		return err
+	}
+	if err := insertAudit(ctx, tx, adminID, "users.unlock", userID, nil); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (s *Service) SetRole(ctx context.Context, adminID, userID, role string) error {
+	if role != middleware.RoleUser && role != middleware.RoleAdmin {
+		return ErrInvalidRole
+	}
+	if adminID == userID {
+		return ErrSelfAction
+	}
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `UPDATE users SET role = $1 WHERE id = $2`, role, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	if err := insertAudit(ctx, tx, adminID, "users.set_role", userID, map[string]any{"role": role}); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// ListProjects shows a user's projects to support, read-only.
+func (s *Service) ListProjects(ctx context.Context, adminID, userID string, page, limit int) ([]projects.Project, projects.ListMeta, error) {
+	if err := s.audit(ctx, adminID, "projects.list", userID, map[string]any{"page": page}); err != nil {
+		return nil, projects.ListMeta{}, err
+	}
+	return s.projects.List(ctx, userID, page, limit)
+}
+
+func (s *Service) GetProject(ctx context.Context, adminID, userID, projectID string) (*projects.Project, error) {
+	if err := s.audit(ctx, adminID, "projects.view", userID, map[string]any{"project_id": projectID}); err != nil {
+		return nil, err
+	}
+	return s.projects.GetByID(ctx, projectID, userID)
+}
+
+func (s *Service) Stats(ctx context.Context, adminID string) (*Stats, error) {
+	if err := s.audit(ctx, adminID, "stats.view", "", nil); err != nil {
+		return nil, err
+	}
+	st := &Stats{}
+	err := s.db.QueryRow(ctx,
+		`SELECT
+		   (SELECT COUNT(*) FROM users),
+		   (SELECT COUNT(*) FROM users WHERE disabled_at IS NOT NULL),
+		   (SELECT COUNT(*) FROM users WHERE deletion_scheduled_at IS NOT NULL),
+		   (SELECT COUNT(*) FROM users WHERE created_at > NOW() - INTERVAL '7 days'),
+		   (SELECT COUNT(*) FROM projects),
+		   (SELECT COUNT(*) FROM projects WHERE updated_at > NOW() - INTERVAL '7 days'),
+		   (SELECT COUNT(*) FROM login_lockouts WHERE unlocked_at IS NULL AND locked_until > NOW())`,
+	).Scan(&st.Users, &st.DisabledUsers, &st.PendingDeletions, &st.NewUsers7d,
+		&st.Projects, &st.ActiveProjects7d, &st.ActiveLockouts)
+	if err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// AuditLog returns audit entries, newest first, optionally for one user.
+// Reading the trail is not itself audited.
+func (s *Service) AuditLog(ctx context.Context, targetUserID string, page, limit int) ([]AuditEntry, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT id, admin_id, action, target_user_id, details, created_at
+		 FROM admin_audit_log
+		 WHERE $1 = '' OR target_user_id::text = $1
+		 ORDER BY created_at DESC LIMIT $2 OFFSET $3`,
+		targetUserID, limit, (page-1)*limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.ID, &e.AdminID, &e.Action, &e.TargetUserID, &e.Details, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, e)
+	}
+	return list, rows.Err()
+}
+
+// CollectGarbage runs an image garbage collection now. The scheduled runs
+// aren't audited; they are in the run history instead.
+func (s *Service) CollectGarbage(ctx context.Context, adminID string, dryRun bool) (*uploads.GCReport, error) {
+	report, err := s.uploads.CollectGarbage(ctx, dryRun)
+	if report == nil {
+		return nil, err
+	}
+	if err := s.audit(ctx, adminID, "storage.gc", "", map[string]any{
+		"run_id": report.ID, "dry_run": dryRun, "deleted": report.Deleted,
+	}); err != nil {
+		return nil, err
+	}
+	return report, err
+}
+
+// RecomputeStorage fixes drift in one user's storage total, or every
+// user's when userID is empty, and returns the totals that changed.
+func (s *Service) RecomputeStorage(ctx context.Context, adminID, userID string) ([]uploads.Recomputed, error) {
+	var changed []uploads.Recomputed
+	if userID == "" {
+		var err error
+		if changed, err = s.uploads.RecomputeAll(ctx); err != nil {
+			return nil, err
+		}
+	} else {
+		r, err := s.uploads.Recompute(ctx, userID)
+		if err != nil {
+			return nil, ErrUserNotFound
+		}
+		changed = []uploads.Recomputed{}
+		if r.Before != r.After {
+			changed = append(changed, *r)
+		}
+	}
+	if err := s.audit(ctx, adminID, "storage.recompute", userID, map[string]any{"changed": len(changed)}); err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
+
+func (s *Service) GCRuns(ctx context.Context, limit int) ([]uploads.GCRun, error) {
+	return s.uploads.GCRuns(ctx, limit)
+}
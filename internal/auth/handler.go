@@ -3,7 +3,12 @@ package auth
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"stringmeup/backend/internal/db"
@@ -14,8 +19,20 @@ func RegisterRoutes(r chi.Router, svc *Service) {
 	r.Post("/auth/register", handleRegister(svc))
 	r.Post("/auth/login", handleLogin(svc))
 	r.Post("/auth/refresh", handleRefresh(svc))
-	r.Delete("/auth/logout", middleware.Authenticate(svc.cfg.JWTSecret)(
-		http.HandlerFunc(handleLogout(svc))).ServeHTTP)
+	r.Post("/auth/mfa/verify", handleVerifyMFA(svc))
+	r.Post("/auth/magic-link", handleRequestMagicLink(svc))
+	r.Post("/auth/magic-link/redeem", handleRedeemMagicLink(svc))
+
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.Authenticate(svc.keys, svc.VerifyPAT, svc.Account))
+		r.Use(middleware.RequireSession)
+		r.Delete("/auth/logout", handleLogout(svc))
+		r.Post("/auth/mfa/enroll", handleEnrollMFA(svc))
+		r.Post("/auth/mfa/confirm", handleConfirmMFA(svc))
+		r.Get("/auth/tokens", handleListTokens(svc))
+		r.Post("/auth/tokens", handleCreateToken(svc))
+		r.Delete("/auth/tokens/{id}", handleRevokeToken(svc))
+	})
 }
 
 func handleRegister(svc *Service) http.HandlerFunc {
@@ -35,6 +52,10 @@ func handleRegister(svc *Service) http.HandlerFunc {
 		}
 
 		user, tokens, err := svc.Register(r.Context(), body.Email, body.Password, body.Name)
+		if errors.Is(err, ErrEmailTaken) {
+			db.Error(w, http.StatusConflict, "EMAIL_TAKEN", err.Error())
+			return
+		}
 		if err != nil {
 			db.Error(w, http.StatusUnprocessableEntity, "VALIDATION_ERROR", err.Error())
 			return
@@ -57,11 +78,28 @@ func handleLogin(svc *Service) http.HandlerFunc {
 			return
 		}
 
-		user, tokens, err := svc.Login(r.Context(), body.Email, body.Password)
+		user, tokens, challenge, err := svc.Login(r.Context(), body.Email, body.Password, clientIP(r))
+		var throttled *ThrottledError
+		if errors.As(err, &throttled) {
+			w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+			db.Error(w, http.StatusTooManyRequests, "TOO_MANY_ATTEMPTS", throttled.Error())
+			return
+		}
+		if errors.Is(err, ErrAccountDisabled) {
+			db.Error(w, http.StatusForbidden, "ACCOUNT_DISABLED", err.Error())
+			return
+		}
 		if err != nil {
 			db.Error(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid credentials")
 			return
 		}
+		if challenge != nil {
+			db.Data(w, http.StatusOK, map[string]any{
+				"mfa_required": true,
+				"mfa":          challenge,
+			})
+			return
+		}
 		db.Data(w, http.StatusOK, map[string]any{
 			"user":   user,
 			"tokens": tokens,
@@ -95,3 +133,175 @@ func handleLogout(svc *Service) http.HandlerFunc {
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
+
+func handleEnrollMFA(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		enrollment, err := svc.EnrollTOTP(r.Context(), middleware.UserID(r))
+		if errors.Is(err, ErrMFAAlreadyEnabled) {
+			db.Error(w, http.StatusConflict, "CONFLICT", err.Error())
+			return
+		}
+		if err != nil {
+			db.Error(w, http.StatusInternalServerError, "SERVER_ERROR", err.Error())
+			return
+		}
+		db.Data(w, http.StatusOK, enrollment)
+	}
+}
+
+func handleConfirmMFA(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Code string `json:"code"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Code == "" {
+			db.Error(w, http.StatusBadRequest, "VALIDATION_ERROR", "code required")
+			return
+		}
+
+		codes, err := svc.ConfirmTOTP(r.Context(), middleware.UserID(r), body.Code)
+		switch {
+		case errors.Is(err, ErrMFAAlreadyEnabled):
+			db.Error(w, http.StatusConflict, "CONFLICT", err.Error())
+			return
+		case errors.Is(err, ErrMFANotEnrolled), errors.Is(err, ErrInvalidMFACode):
+			db.Error(w, http.StatusUnprocessableEntity, "VALIDATION_ERROR", err.Error())
+			return
+		case err != nil:
+			db.Error(w, http.StatusInternalServerError, "SERVER_ERROR", err.Error())
+			return
+		}
+		db.Data(w, http.StatusOK, map[string]any{"recovery_codes": codes})
+	}
+}
+
+func handleVerifyMFA(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			ChallengeToken string `json:"challenge_token"`
+			Code           string `json:"code"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil ||
+			body.ChallengeToken == "" || body.Code == "" {
+			db.Error(w, http.StatusBadRequest, "VALIDATION_ERROR", "challenge_token and code required")
+			return
+		}
+
+		user, tokens, err := svc.VerifyMFA(r.Context(), body.ChallengeToken, body.Code)
+		if err != nil {
+			db.Error(w, http.StatusUnauthorized, "UNAUTHORIZED", err.Error())
+			return
+		}
+		db.Data(w, http.StatusOK, map[string]any{
+			"user":   user,
+			"tokens": tokens,
+		})
+	}
+}
+
+func handleRequestMagicLink(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Email string `json:"email"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Email == "" {
+			db.Error(w, http.StatusBadRequest, "VALIDATION_ERROR", "email required")
+			return
+		}
+		// Same response, just as fast, whether or not the account exists
+		svc.RequestMagicLink(r.Context(), body.Email)
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func handleRedeemMagicLink(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Token string `json:"token"`
+			Email string `json:"email"`
+			Code  string `json:"code"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil ||
+			(body.Token == "" && (body.Email == "" || body.Code == "")) {
+			db.Error(w, http.StatusBadRequest, "VALIDATION_ERROR", "token, or email and code, required")
+			return
+		}
+
+		user, tokens, challenge, err := svc.RedeemMagicLink(r.Context(), body.Token, body.Email, body.Code)
+		if err != nil {
+			db.Error(w, http.StatusUnauthorized, "UNAUTHORIZED", err.Error())
+			return
+		}
+		if challenge != nil {
+			db.Data(w, http.StatusOK, map[string]any{
+				"mfa_required": true,
+				"mfa":          challenge,
+			})
+			return
+		}
+		db.Data(w, http.StatusOK, map[string]any{
+			"user":   user,
+			"tokens": tokens,
+		})
+	}
+}
+
+func handleListTokens(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pats, err := svc.ListPATs(r.Context(), middleware.UserID(r))
+		if err != nil {
+			db.Error(w, http.StatusInternalServerError, "SERVER_ERROR", err.Error())
+			return
+		}
+		db.Data(w, http.StatusOK, pats)
+	}
+}
+
+func handleCreateToken(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Name          string   `json:"name"`
+			Scopes        []string `json:"scopes"`
+			ExpiresInDays int      `json:"expires_in_days"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			db.Error(w, http.StatusBadRequest, "VALIDATION_ERROR", "invalid body")
+			return
+		}
+		var expiresAt *time.Time
+		if body.ExpiresInDays > 0 {
+			t := time.Now().UTC().AddDate(0, 0, body.ExpiresInDays)
+			expiresAt = &t
+		}
+
+		pat, token, err := svc.CreatePAT(r.Context(), middleware.UserID(r), body.Name, body.Scopes, expiresAt)
+		if err != nil {
+			db.Error(w, http.StatusUnprocessableEntity, "VALIDATION_ERROR", err.Error())
+			return
+		}
+		db.Data(w, http.StatusCreated, map[string]any{
+			"token":                 token,
+			"personal_access_token": pat,
+		})
+	}
+}
+
+func handleRevokeToken(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := svc.RevokePAT(r.Context(), middleware.UserID(r), chi.URLParam(r, "id")); err != nil {
+			db.Error(w, http.StatusNotFound, "NOT_FOUND", "token not found")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// clientIP returns the caller's address without the port. RealIP has
+// already replaced RemoteAddr with the forwarded address when the request
+// came through a trusted proxy.
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
@@ -0,0 +1,151 @@
+// internal/auth/magiclink.go
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"stringmeup/backend/internal/i18n"
+	"stringmeup/backend/internal/mail"
+)
+
+const (
+	magicLinkTTL       = 15 * time.Minute
+	magicLinkPerHour   = 5
+	magicLinkCodeTries = 5
+)
+
+var ErrInvalidMagicLink = errors.New("invalid or expired login link")
+
+// RequestMagicLink emails a login link and code to email. Unknown
+// addresses and requests over the hourly limit are silently dropped, and
+// the link is created and sent in the background, so neither the result
+// nor its timing tells callers which emails have accounts.
+func (s *Service) RequestMagicLink(ctx context.Context, email string) {
+	var userID, locale string
+	var recent int
+	err := s.db.QueryRow(ctx,
+		`SELECT u.id, COALESCE(u.preferences->>'locale', ''),
+		        (SELECT COUNT(*) FROM magic_links m
+		         WHERE m.user_id = u.id AND m.created_at > NOW() - INTERVAL '1 hour')
+		 FROM users u WHERE u.email = $1`, email,
+	).Scan(&userID, &locale, &recent)
+	if err != nil || recent >= magicLinkPerHour {
+		return
+	}
+	loc := i18n.Resolve(ctx, locale)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+		defer cancel()
+		if err := s.sendMagicLink(ctx, userID, email, loc); err != nil {
+			log.Printf("auth: magic link for %s: %v", userID, err)
+		}
+	}()
+}
+
+// sendMagicLink creates a link for the user and emails it to them.
+func (s *Service) sendMagicLink(ctx context.Context, userID, email, loc string) error {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+
+	id := uuid.New().String()
+	_, err = s.db.Exec(ctx,
+		`INSERT INTO magic_links (id, user_id, token_hash, code_hash, expires_at)
+		 VALUES ($1, $2, $3, $4, $5)`,
+		id, userID, hashMagicToken(token), hashMagicCode(id, code),
+		time.Now().UTC().Add(magicLinkTTL),
+	)
+	if err != nil {
+		return fmt.Errorf("insert magic link: %w", err)
+	}
+
+	link := fmt.Sprintf("%s/auth/magic-link?token=%s", s.cfg.AppURL, url.QueryEscape(token))
+	return s.mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: i18n.T(loc, "email.magic_link.subject"),
+		Text:    i18n.T(loc, "email.magic_link.body", link, code, int(magicLinkTTL.Minutes())),
+	})
+}
+
+// RedeemMagicLink exchanges either a link token, or an email and code, for
+// a login. Like Login it returns an MFAChallenge instead of Tokens when the
+// user has 2FA enabled.
+func (s *Service) RedeemMagicLink(ctx context.Context, token, email, code string) (*User, *Tokens, *MFAChallenge, error) {
+	var userID string
+	if token != "" {
+		err := s.db.QueryRow(ctx,
+			`UPDATE magic_links SET used_at = NOW()
+			 WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+			 RETURNING user_id`, hashMagicToken(token),
+		).Scan(&userID)
+		if err != nil {
+			return nil, nil, nil, ErrInvalidMagicLink
+		}
+	} else {
+		// Only the newest outstanding link accepts a code, and each wrong
+		// guess burns one of its attempts.
+		var id, codeHash string
+		err := s.db.QueryRow(ctx,
+			`UPDATE magic_links SET attempts = attempts + 1
+			 WHERE id = (
+			   SELECT m.id FROM magic_links m JOIN users u ON u.id = m.user_id
+			   WHERE u.email = $1 AND m.used_at IS NULL AND m.expires_at > NOW()
+			   ORDER BY m.created_at DESC LIMIT 1)
+			   AND attempts < $2
+			 RETURNING id, user_id, code_hash`, email, magicLinkCodeTries,
+		).Scan(&id, &userID, &codeHash)
+		if err != nil {
+			return nil, nil, nil, ErrInvalidMagicLink
+		}
+		if subtle.ConstantTimeCompare([]byte(codeHash), []byte(hashMagicCode(id, code))) != 1 {
+			return nil, nil, nil, ErrInvalidMagicLink
+		}
+		tag, err := s.db.Exec(ctx,
+			`UPDATE magic_links SET used_at = NOW() WHERE id = $1 AND used_at IS NULL`, id)
+		if err != nil || tag.RowsAffected() == 0 {
+			return nil, nil, nil, ErrInvalidMagicLink
+		}
+	}
+
+	var user User
+	var totpEnabled bool
+	err := s.db.QueryRow(ctx,
+		`SELECT id, email, name, created_at, totp_enabled FROM users WHERE id = $1`, userID,
+	).Scan(&user.ID, &user.Email, &user.Name, &user.CreatedAt, &totpEnabled)
+	if err != nil {
+		return nil, nil, nil, ErrInvalidMagicLink
+	}
+	return s.completeLogin(ctx, &user, totpEnabled)
+}
+
+func hashMagicToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// hashMagicCode salts the code with its link ID so equal codes on different
+// links don't share a hash. The attempt limit is what actually protects a
+// six-digit code.
+func hashMagicCode(linkID, code string) string {
+	sum := sha256.Sum256([]byte(linkID + ":" + code))
+	return hex.EncodeToString(sum[:])
+}
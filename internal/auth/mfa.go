@@ -0,0 +1,215 @@
+// internal/auth/mfa.go
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"stringmeup/backend/internal/notifications"
+)
+
+const (
+	recoveryCodeCount = 10
+	mfaChallengeTTL   = 5 * time.Minute
+	mfaChallengeTries = 5
+)
+
+var (
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnrolled    = errors.New("two-factor authentication is not enrolled")
+	ErrInvalidMFACode    = errors.New("invalid code")
+	ErrInvalidChallenge  = errors.New("invalid or expired challenge")
+)
+
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+type MFAChallenge struct {
+	Token     string    `json:"challenge_token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// EnrollTOTP generates a new secret for the user. 2FA stays disabled until
+// the first code is confirmed, so an abandoned enrollment is harmless.
+func (s *Service) EnrollTOTP(ctx context.Context, userID string) (*TOTPEnrollment, error) {
+	var email string
+	var enabled bool
+	err := s.db.QueryRow(ctx,
+		`SELECT email, totp_enabled FROM users WHERE id = $1`, userID,
+	).Scan(&email, &enabled)
+	if err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+	if enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.db.Exec(ctx,
+		`UPDATE users SET totp_secret = $1, totp_last_step = 0 WHERE id = $2`,
+		secret, userID)
+	if err != nil {
+		return nil, fmt.Errorf("store totp secret: %w", err)
+	}
+
+	return &TOTPEnrollment{Secret: secret, URI: otpauthURI(email, secret)}, nil
+}
+
+// ConfirmTOTP enables 2FA once the user proves their authenticator works,
+// and returns a fresh set of recovery codes. The plaintext codes are only
+// ever shown here.
+func (s *Service) ConfirmTOTP(ctx context.Context, userID, code string) ([]string, error) {
+	var secret *string
+	var enabled bool
+	var lastStep int64
+	err := s.db.QueryRow(ctx,
+		`SELECT totp_secret, totp_enabled, totp_last_step FROM users WHERE id = $1`, userID,
+	).Scan(&secret, &enabled, &lastStep)
+	if err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+	if enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if secret == nil {
+		return nil, ErrMFANotEnrolled
+	}
+
+	step, ok := validateTOTP(*secret, code, time.Now(), lastStep)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		if codes[i], err = newRecoveryCode(); err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx,
+		`UPDATE users SET totp_enabled = TRUE, totp_last_step = $1 WHERE id = $2`,
+		step, userID); err != nil {
+		return nil, fmt.Errorf("enable totp: %w", err)
+	}
+	if _, err := tx.Exec(ctx,
+		`DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return nil, fmt.Errorf("clear recovery codes: %w", err)
+	}
+	for _, c := range codes {
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`,
+			userID, hashRecoveryCode(c)); err != nil {
+			return nil, fmt.Errorf("store recovery code: %w", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	s.notify.Notify(ctx, userID, notifications.KindSecurity, "notification.mfa_enabled", nil, nil)
+	return codes, nil
+}
+
+// VerifyMFA completes a login started by Login. code may be either a TOTP
+// code or one of the user's unused recovery codes.
+func (s *Service) VerifyMFA(ctx context.Context, challengeToken, code string) (*User, *Tokens, error) {
+	var userID string
+	err := s.db.QueryRow(ctx,
+		`UPDATE mfa_challenges SET attempts = attempts + 1
+		 WHERE token = $1 AND expires_at > NOW() AND attempts < $2
+		 RETURNING user_id`,
+		challengeToken, mfaChallengeTries,
+	).Scan(&userID)
+	if err != nil {
+		return nil, nil, ErrInvalidChallenge
+	}
+
+	var user User
+	var secret string
+	var lastStep int64
+	err = s.db.QueryRow(ctx,
+		`SELECT id, email, name, created_at, COALESCE(totp_secret, ''), totp_last_step
+		 FROM users WHERE id = $1`, userID,
+	).Scan(&user.ID, &user.Email, &user.Name, &user.CreatedAt, &secret, &lastStep)
+	if err != nil {
+		return nil, nil, ErrInvalidChallenge
+	}
+
+	code = strings.TrimSpace(code)
+	if step, ok := validateTOTP(secret, code, time.Now(), lastStep); ok {
+		// Guard against two concurrent requests racing on the same code.
+		tag, err := s.db.Exec(ctx,
+			`UPDATE users SET totp_last_step = $1 WHERE id = $2 AND totp_last_step < $1`,
+			step, userID)
+		if err != nil || tag.RowsAffected() == 0 {
+			return nil, nil, ErrInvalidMFACode
+		}
+	} else {
+		tag, err := s.db.Exec(ctx,
+			`UPDATE mfa_recovery_codes SET used_at = NOW()
+			 WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`,
+			userID, hashRecoveryCode(code))
+		if err != nil || tag.RowsAffected() == 0 {
+			return nil, nil, ErrInvalidMFACode
+		}
+	}
+
+	s.db.Exec(ctx, `DELETE FROM mfa_challenges WHERE token = $1`, challengeToken)
+
+	tokens, err := s.issueTokens(ctx, user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &user, tokens, nil
+}
+
+func (s *Service) createMFAChallenge(ctx context.Context, userID string) (*MFAChallenge, error) {
+	c := &MFAChallenge{
+		Token:     uuid.New().String(),
+		ExpiresAt: time.Now().UTC().Add(mfaChallengeTTL),
+	}
+	_, err := s.db.Exec(ctx,
+		`INSERT INTO mfa_challenges (token, user_id, expires_at) VALUES ($1, $2, $3)`,
+		c.Token, userID, c.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("store mfa challenge: %w", err)
+	}
+	return c, nil
+}
+
+// newRecoveryCode returns a code like "k3f9q-7xw2m".
+func newRecoveryCode() (string, error) {
+	buf := make([]byte, 7)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	s := strings.ToLower(b32.EncodeToString(buf))[:10]
+	return s[:5] + "-" + s[5:], nil
+}
+
+// hashRecoveryCode normalises formatting before hashing so users can type
+// codes with or without the dash and in any case. The codes carry enough
+// entropy that a fast hash is sufficient.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,135 @@
+// internal/auth/pat.go
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"stringmeup/backend/internal/middleware"
+	"stringmeup/backend/internal/notifications"
+)
+
+var ErrInvalidPAT = errors.New("invalid or revoked token")
+
+type PersonalAccessToken struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	TokenHint  string     `json:"token_hint"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreatePAT returns the stored token and its plaintext value, which is only
+// ever shown here. A nil expiresAt creates a token that never expires.
+func (s *Service) CreatePAT(ctx context.Context, userID, name string, scopes []string, expiresAt *time.Time) (*PersonalAccessToken, string, error) {
+	if name == "" {
+		return nil, "", fmt.Errorf("name required")
+	}
+	if len(scopes) == 0 {
+		return nil, "", fmt.Errorf("at least one scope required")
+	}
+	for _, sc := range scopes {
+		if !slices.Contains(middleware.KnownScopes, sc) {
+			return nil, "", fmt.Errorf("unknown scope %q", sc)
+		}
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", err
+	}
+	token := middleware.PATPrefix + base64.RawURLEncoding.EncodeToString(buf)
+
+	pat := &PersonalAccessToken{
+		ID:        uuid.New().String(),
+		Name:      name,
+		TokenHint: token[len(token)-4:],
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now().UTC(),
+	}
+	_, err := s.db.Exec(ctx,
+		`INSERT INTO personal_access_tokens
+		   (id, user_id, name, token_hash, token_hint, scopes, expires_at, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		pat.ID, userID, pat.Name, hashPAT(token), pat.TokenHint, pat.Scopes,
+		pat.ExpiresAt, pat.CreatedAt,
+	)
+	if err != nil {
+		return nil, "", fmt.Errorf("insert token: %w", err)
+	}
+	s.notify.Notify(ctx, userID, notifications.KindSecurity, "notification.token_created",
+		[]any{name}, map[string]any{"token_id": pat.ID})
+	return pat, token, nil
+}
+
+// ListPATs returns the user's unrevoked tokens, newest first.
+func (s *Service) ListPATs(ctx context.Context, userID string) ([]PersonalAccessToken, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT id, name, token_hint, scopes, expires_at, last_used_at, created_at
+		 FROM personal_access_tokens
+		 WHERE user_id = $1 AND revoked_at IS NULL
+		 ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pats := []PersonalAccessToken{}
+	for rows.Next() {
+		var p PersonalAccessToken
+		if err := rows.Scan(&p.ID, &p.Name, &p.TokenHint, &p.Scopes,
+			&p.ExpiresAt, &p.LastUsedAt, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		pats = append(pats, p)
+	}
+	return pats, rows.Err()
+}
+
+func (s *Service) RevokePAT(ctx context.Context, userID, id string) error {
+	tag, err := s.db.Exec(ctx,
+		`UPDATE personal_access_tokens SET revoked_at = NOW()
+		 WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`, id, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("token not found")
+	}
+	return nil
+}
+
+// VerifyPAT implements middleware.PATVerifier.
+func (s *Service) VerifyPAT(ctx context.Context, token string) (string, []string, error) {
+	var userID string
+	var scopes []string
+	err := s.db.QueryRow(ctx,
+		`UPDATE personal_access_tokens SET last_used_at = NOW()
+		 WHERE token_hash = $1 AND revoked_at IS NULL
+		   AND (expires_at IS NULL OR expires_at > NOW())
+		 RETURNING user_id, scopes`, hashPAT(token),
+	).Scan(&userID, &scopes)
+	if err != nil {
+		return "", nil, ErrInvalidPAT
+	}
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return userID, scopes, nil
+}
+
+func hashPAT(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
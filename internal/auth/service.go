@@ -3,25 +3,45 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"golang.org/x/crypto/bcrypt"
 	"stringmeup/backend/internal/config"
+	"stringmeup/backend/internal/mail"
+	"stringmeup/backend/internal/middleware"
+	"stringmeup/backend/internal/notifications"
+	"stringmeup/backend/internal/signing"
 )
 
 type Service struct {
-	db  *pgxpool.Pool
-	cfg *config.Config
+	db     *pgxpool.Pool
+	cfg    *config.Config
+	keys   *signing.Keyring
+	mailer mail.Mailer
+	notify *notifications.Service
+	// dummyHash is compared against when the email is unknown, so that
+	// path costs the same as a wrong password.
+	dummyHash string
 }
 
-func NewService(db *pgxpool.Pool, cfg *config.Config) *Service {
-	return &Service{db: db, cfg: cfg}
+func NewService(db *pgxpool.Pool, cfg *config.Config, keys *signing.Keyring, mailer mail.Mailer,
+	notify *notifications.Service) *Service {
+	dummy, _ := bcrypt.GenerateFromPassword([]byte(uuid.New().String()), bcrypt.DefaultCost)
+	return &Service{db: db, cfg: cfg, keys: keys, mailer: mailer, notify: notify, dummyHash: string(dummy)}
 }
 
+var (
+	ErrEmailTaken      = errors.New("email is already in use")
+	ErrAccountDisabled = errors.New("account is disabled")
+)
+
 type User struct {
 	ID        string    `json:"id"`
 	Email     string    `json:"email"`
@@ -53,6 +73,10 @@ func (s *Service) Register(ctx context.Context, email, password, name string) (*
 		 VALUES ($1, $2, $3, $4, $5)`,
 		user.ID, user.Email, string(hash), user.Name, user.CreatedAt,
 	)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return nil, nil, ErrEmailTaken
+	}
 	if err != nil {
 		return nil, nil, fmt.Errorf("insert user: %w", err)
 	}
@@ -64,36 +88,67 @@ func (s *Service) Register(ctx context.Context, email, password, name string) (*
 	return user, tokens, nil
 }
 
-func (s *Service) Login(ctx context.Context, email, password string) (*User, *Tokens, error) {
+// Login checks the password. When the user has 2FA enabled it returns an
+// MFAChallenge instead of Tokens; the login is completed by VerifyMFA.
+//
+// Attempts are throttled per email and per IP. Unknown emails go through
+// the same bcrypt comparison and throttling as known ones so neither the
+// response nor its timing reveals whether an account exists.
+func (s *Service) Login(ctx context.Context, email, password, ip string) (*User, *Tokens, *MFAChallenge, error) {
+	key := normalizeEmail(email)
+	attempt, err := s.beginAttempt(ctx, key, ip)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
 	var user User
-	var hash string
-	err := s.db.QueryRow(ctx,
-		`SELECT id, email, name, password_hash, created_at FROM users WHERE email = $1`,
+	hash := s.dummyHash
+	var totpEnabled bool
+	err = s.db.QueryRow(ctx,
+		`SELECT id, email, name, password_hash, created_at, totp_enabled FROM users WHERE email = $1`,
 		email,
-	).Scan(&user.ID, &user.Email, &user.Name, &hash, &user.CreatedAt)
-	if err != nil {
-		return nil, nil, fmt.Errorf("user not found")
+	).Scan(&user.ID, &user.Email, &user.Name, &hash, &user.CreatedAt, &totpEnabled)
+	found := err == nil
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil || !found {
+		if err := s.finishAttempt(ctx, attempt, key, ip, false); err != nil {
+			return nil, nil, nil, err
+		}
+		return nil, nil, nil, ErrInvalidCredentials
 	}
+	if err := s.finishAttempt(ctx, attempt, key, ip, true); err != nil {
+		return nil, nil, nil, err
+	}
+	return s.completeLogin(ctx, &user, totpEnabled)
+}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
-		return nil, nil, fmt.Errorf("invalid credentials")
+// completeLogin issues tokens for a user whose first factor has been
+// checked, or an MFAChallenge if they have 2FA enabled.
+func (s *Service) completeLogin(ctx context.Context, user *User, totpEnabled bool) (*User, *Tokens, *MFAChallenge, error) {
+	if totpEnabled {
+		challenge, err := s.createMFAChallenge(ctx, user.ID)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return user, nil, challenge, nil
 	}
 
 	tokens, err := s.issueTokens(ctx, user.ID)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
-	return &user, tokens, nil
+	return user, tokens, nil, nil
 }
 
 func (s *Service) Refresh(ctx context.Context, refreshToken string) (*Tokens, error) {
 	// Validate the refresh token from DB
 	var userID string
+	var sessionID *string
 	err := s.db.QueryRow(ctx,
-		`SELECT user_id FROM refresh_tokens
+		`SELECT user_id, session_id::text FROM refresh_tokens
 		 WHERE token = $1 AND expires_at > NOW()`,
 		refreshToken,
-	).Scan(&userID)
+	).Scan(&userID, &sessionID)
 	if err != nil {
 		return nil, fmt.Errorf("invalid or expired refresh token")
 	}
@@ -101,7 +156,11 @@ func (s *Service) Refresh(ctx context.Context, refreshToken string) (*Tokens, er
 	// Rotate: delete old token
 	s.db.Exec(ctx, `DELETE FROM refresh_tokens WHERE token = $1`, refreshToken)
 
-	return s.issueTokens(ctx, userID)
+	// Tokens from before sessions had IDs start one now
+	if sessionID == nil {
+		return s.issueTokens(ctx, userID)
+	}
+	return s.issueSessionTokens(ctx, userID, *sessionID)
 }
 
 func (s *Service) Logout(ctx context.Context, userID string) error {
@@ -110,26 +169,93 @@ func (s *Service) Logout(ctx context.Context, userID string) error {
 	return err
 }
 
+// Run prunes expired refresh tokens, MFA challenges, magic links and old
+// login attempts until ctx is cancelled.
+func (s *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, q := range []string{
+				`DELETE FROM refresh_tokens WHERE expires_at < NOW()`,
+				`DELETE FROM mfa_challenges WHERE expires_at < NOW()`,
+				`DELETE FROM login_attempts WHERE created_at < NOW() - INTERVAL '7 days'`,
+				`DELETE FROM magic_links WHERE expires_at < NOW() - INTERVAL '1 day'`,
+			} {
+				if _, err := s.db.Exec(ctx, q); err != nil {
+					log.Printf("auth: prune: %v", err)
+				}
+			}
+		}
+	}
+}
+
+// Account implements middleware.AccountLookup.
+func (s *Service) Account(ctx context.Context, userID string) (*middleware.Account, error) {
+	a := &middleware.Account{}
+	var disabledAt *time.Time
+	err := s.db.QueryRow(ctx,
+		`SELECT role, disabled_at, sessions_revoked_at, COALESCE(sessions_kept_id::text, ''),
+		        COALESCE(NULLIF(preferences->>'locale', 'auto'), '')
+		 FROM users WHERE id = $1`, userID,
+	).Scan(&a.Role, &disabledAt, &a.SessionsRevokedAt, &a.SessionKept, &a.Locale)
+	if err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+	a.Disabled = disabledAt != nil
+	return a, nil
+}
+
+// issueTokens starts a new session for the user.
 func (s *Service) issueTokens(ctx context.Context, userID string) (*Tokens, error) {
+	return s.issueSessionTokens(ctx, userID, uuid.New().String())
+}
+
+// issueSessionTokens issues tokens for the session sessionID, whose ID the
+// access token carries as its jti.
+func (s *Service) issueSessionTokens(ctx context.Context, userID, sessionID string) (*Tokens, error) {
+	// Every login path and refresh ends here, so this is the one place a
+	// disabled account needs to be turned away
+	var disabled bool
+	if err := s.db.QueryRow(ctx,
+		`SELECT disabled_at IS NOT NULL FROM users WHERE id = $1`, userID,
+	).Scan(&disabled); err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+	if disabled {
+		return nil, ErrAccountDisabled
+	}
+
 	expiresAt := time.Now().UTC().Add(time.Hour)
 
-	accessToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+	accessToken, err := s.keys.Sign(jwt.RegisteredClaims{
+		ID:        sessionID,
 		Subject:   userID,
 		ExpiresAt: jwt.NewNumericDate(expiresAt),
 		IssuedAt:  jwt.NewNumericDate(time.Now()),
-	}).SignedString([]byte(s.cfg.JWTSecret))
+	})
 	if err != nil {
 		return nil, err
 	}
 
+	// Logging in during the grace period cancels a pending account deletion
+	if _, err := s.db.Exec(ctx,
+		`UPDATE users SET deletion_scheduled_at = NULL
+		 WHERE id = $1 AND deletion_scheduled_at IS NOT NULL`, userID); err != nil {
+		return nil, fmt.Errorf("cancel deletion: %w", err)
+	}
+
 	refreshToken := uuid.New().String()
 	refreshExpiry := time.Now().UTC().Add(30 * 24 * time.Hour)
 
 	_, err = s.db.Exec(ctx,
-		`INSERT INTO refresh_tokens (token, user_id, expires_at)
-		 VALUES ($1, $2, $3)
+		`INSERT INTO refresh_tokens (token, user_id, expires_at, session_id)
+		 VALUES ($1, $2, $3, $4)
 		 ON CONFLICT (token) DO NOTHING`,
-		refreshToken, userID, refreshExpiry,
+		refreshToken, userID, refreshExpiry, sessionID,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("store refresh token: %w", err)
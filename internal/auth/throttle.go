@@ -0,0 +1,303 @@
+// internal/auth/throttle.go
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"stringmeup/backend/internal/notifications"
+)
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// ThrottledError is returned by Login while an account or IP is backing off
+// or locked out.
+type ThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("too many failed attempts, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+// throttlePolicy describes how failures for one scope (an email or an IP)
+// are treated. Failures are counted within window, since the scope's last
+// lockout and, if resetOnSuccess, its last success. From backoffAfter
+// failures on, each further attempt must wait 1s, 2s, 4s... after the
+// previous failure; at lockAfter the scope is locked for lockFor, doubling
+// with each lockout in a day.
+type throttlePolicy struct {
+	column         string
+	backoffAfter   int
+	lockAfter      int
+	lockFor        time.Duration
+	window         time.Duration
+	resetOnSuccess bool
+}
+
+var (
+	accountPolicy = throttlePolicy{column: "email", backoffAfter: 5, lockAfter: 10, lockFor: 15 * time.Minute, window: time.Hour, resetOnSuccess: true}
+	// A success never resets an IP, or an attacker could sign in to their
+	// own account between guesses at others
+	ipPolicy = throttlePolicy{column: "ip", backoffAfter: 20, lockAfter: 100, lockFor: time.Hour, window: time.Hour}
+)
+
+const (
+	maxBackoff = 5 * time.Minute
+	maxLockout = 24 * time.Hour
+)
+
+// LoginLockout is a lockout event as shown to support.
+type LoginLockout struct {
+	ID          string     `json:"id"`
+	Email       *string    `json:"email"`
+	IP          *string    `json:"ip"`
+	Failures    int        `json:"failures"`
+	LockedUntil time.Time  `json:"locked_until"`
+	UnlockedAt  *time.Time `json:"unlocked_at"`
+	UnlockedBy  *string    `json:"unlocked_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// beginAttempt decides whether a login attempt for email from ip may go
+// ahead and, if so, records it as failed until finishAttempt says
+// otherwise. The decision and the insert run under locks on the email and
+// the IP, so parallel guesses each see the ones before them and can't all
+// slip past the backoff together.
+func (s *Service) beginAttempt(ctx context.Context, email, ip string) (int64, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+	if err := lockScopes(ctx, tx, email, ip); err != nil {
+		return 0, err
+	}
+	if err := checkThrottle(ctx, tx, email, ip); err != nil {
+		return 0, err
+	}
+	var id int64
+	if err := tx.QueryRow(ctx,
+		`INSERT INTO login_attempts (email, ip, succeeded) VALUES ($1, $2, FALSE) RETURNING id`,
+		email, ip).Scan(&id); err != nil {
+		return 0, fmt.Errorf("record attempt: %w", err)
+	}
+	return id, tx.Commit(ctx)
+}
+
+// finishAttempt records the outcome of an attempt begun by beginAttempt
+// and, on failure, locks any scope that has crossed its threshold.
+func (s *Service) finishAttempt(ctx context.Context, id int64, email, ip string, succeeded bool) error {
+	if succeeded {
+		_, err := s.db.Exec(ctx, `UPDATE login_attempts SET succeeded = TRUE WHERE id = $1`, id)
+		return err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if err := lockScopes(ctx, tx, email, ip); err != nil {
+		return err
+	}
+	var locked []throttlePolicy
+	for _, c := range []struct {
+		p     throttlePolicy
+		value string
+	}{{accountPolicy, email}, {ipPolicy, ip}} {
+		failures, _, err := recentFailures(ctx, tx, c.p, c.value)
+		if err != nil {
+			return err
+		}
+		if failures < c.p.lockAfter {
+			continue
+		}
+		if err := lock(ctx, tx, c.p, c.value, failures); err != nil {
+			return err
+		}
+		locked = append(locked, c.p)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	for _, p := range locked {
+		if p.column == accountPolicy.column {
+			s.notifyLocked(ctx, email)
+		}
+	}
+	return nil
+}
+
+// lockScopes serializes attempts on the same email or IP until tx ends.
+// The email is always locked first, so two attempts can't deadlock.
+func lockScopes(ctx context.Context, tx pgx.Tx, email, ip string) error {
+	for _, scope := range []string{"login:email:" + email, "login:ip:" + ip} {
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended($1, 0))`, scope); err != nil {
+			return fmt.Errorf("lock %s: %w", scope, err)
+		}
+	}
+	return nil
+}
+
+// checkThrottle returns a *ThrottledError if either the email or the IP
+// must wait before trying again.
+func checkThrottle(ctx context.Context, tx pgx.Tx, email, ip string) error {
+	var wait time.Duration
+	for _, c := range []struct {
+		p     throttlePolicy
+		value string
+	}{{accountPolicy, email}, {ipPolicy, ip}} {
+		d, err := retryAfter(ctx, tx, c.p, c.value)
+		if err != nil {
+			return err
+		}
+		if d > wait {
+			wait = d
+		}
+	}
+	if wait > 0 {
+		return &ThrottledError{RetryAfter: wait}
+	}
+	return nil
+}
+
+func retryAfter(ctx context.Context, tx pgx.Tx, p throttlePolicy, value string) (time.Duration, error) {
+	now := time.Now()
+
+	var lockedUntil *time.Time
+	err := tx.QueryRow(ctx, fmt.Sprintf(
+		`SELECT MAX(locked_until) FROM login_lockouts
+		 WHERE %s = $1 AND unlocked_at IS NULL AND locked_until > NOW()`, p.column),
+		value,
+	).Scan(&lockedUntil)
+	if err != nil {
+		return 0, fmt.Errorf("check lockout: %w", err)
+	}
+	if lockedUntil != nil {
+		return lockedUntil.Sub(now), nil
+	}
+
+	failures, last, err := recentFailures(ctx, tx, p, value)
+	if err != nil || failures < p.backoffAfter {
+		return 0, err
+	}
+	backoff := time.Second << (failures - p.backoffAfter)
+	if backoff > maxBackoff || backoff <= 0 {
+		backoff = maxBackoff
+	}
+	if wait := last.Add(backoff).Sub(now); wait > 0 {
+		return wait, nil
+	}
+	return 0, nil
+}
+
+func recentFailures(ctx context.Context, tx pgx.Tx, p throttlePolicy, value string) (int, time.Time, error) {
+	var sinceSuccess string
+	if p.resetOnSuccess {
+		sinceSuccess = fmt.Sprintf(
+			`AND created_at > COALESCE((SELECT MAX(created_at) FROM login_attempts
+			                            WHERE %s = $1 AND succeeded), '-infinity')`, p.column)
+	}
+	var n int
+	var last *time.Time
+	err := tx.QueryRow(ctx, fmt.Sprintf(
+		`SELECT COUNT(*), MAX(created_at) FROM login_attempts
+		 WHERE %[1]s = $1 AND NOT succeeded AND created_at > $2 %[2]s
+		   AND created_at > COALESCE((SELECT MAX(created_at) FROM login_lockouts
+		                              WHERE %[1]s = $1), '-infinity')`, p.column, sinceSuccess),
+		value, time.Now().Add(-p.window),
+	).Scan(&n, &last)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("count failures: %w", err)
+	}
+	if last == nil {
+		return n, time.Time{}, nil
+	}
+	return n, *last, nil
+}
+
+func lock(ctx context.Context, tx pgx.Tx, p throttlePolicy, value string, failures int) error {
+	var recent int
+	err := tx.QueryRow(ctx, fmt.Sprintf(
+		`SELECT COUNT(*) FROM login_lockouts
+		 WHERE %s = $1 AND created_at > NOW() - INTERVAL '24 hours'`, p.column),
+		value,
+	).Scan(&recent)
+	if err != nil {
+		return fmt.Errorf("count lockouts: %w", err)
+	}
+
+	d := p.lockFor << recent
+	if d > maxLockout || d <= 0 {
+		d = maxLockout
+	}
+	_, err = tx.Exec(ctx, fmt.Sprintf(
+		`INSERT INTO login_lockouts (%s, failures, locked_until) VALUES ($1, $2, $3)`, p.column),
+		value, failures, time.Now().UTC().Add(d))
+	if err != nil {
+		return fmt.Errorf("insert lockout: %w", err)
+	}
+	return nil
+}
+
+// notifyLocked tells the owner of email, if there is one, that their
+// account was locked.
+func (s *Service) notifyLocked(ctx context.Context, email string) {
+	var userID string
+	if err := s.db.QueryRow(ctx,
+		`SELECT id FROM users WHERE LOWER(email) = $1`, email).Scan(&userID); err == nil {
+		s.notify.Notify(ctx, userID, notifications.KindSecurity, "notification.sign_in_locked", nil, nil)
+	}
+}
+
+// Lockouts returns the lockout history for the user's email, newest first.
+func (s *Service) Lockouts(ctx context.Context, userID string) ([]LoginLockout, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT l.id, l.email, l.ip, l.failures, l.locked_until,
+		        l.unlocked_at, l.unlocked_by, l.created_at
+		 FROM login_lockouts l JOIN users u ON l.email = LOWER(u.email)
+		 WHERE u.id = $1
+		 ORDER BY l.created_at DESC LIMIT 50`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lockouts := []LoginLockout{}
+	for rows.Next() {
+		var l LoginLockout
+		if err := rows.Scan(&l.ID, &l.Email, &l.IP, &l.Failures, &l.LockedUntil,
+			&l.UnlockedAt, &l.UnlockedBy, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		lockouts = append(lockouts, l)
+	}
+	return lockouts, rows.Err()
+}
+
+// Unlock lifts any active lockout on the user's email, and on the IPs the
+// user signed in from successfully in the last day, which may be what
+// keeps them out. IPs that only failed are left locked, since they may be
+// an attacker's. unlockedBy records who did it, e.g. a support agent's user
+// ID. It runs in tx so the caller can record the unlock alongside it.
+func (s *Service) Unlock(ctx context.Context, tx pgx.Tx, userID, unlockedBy string) error {
+	_, err := tx.Exec(ctx,
+		`WITH account AS (SELECT LOWER(email) AS email FROM users WHERE id = $1)
+		 UPDATE login_lockouts SET unlocked_at = NOW(), unlocked_by = $2
+		 WHERE unlocked_at IS NULL AND locked_until > NOW()
+		   AND (email = (SELECT email FROM account)
+		        OR ip IN (SELECT ip FROM login_attempts
+		                  WHERE email = (SELECT email FROM account) AND succeeded
+		                    AND created_at > NOW() - INTERVAL '24 hours'))`,
+		userID, unlockedBy)
+	return err
+}
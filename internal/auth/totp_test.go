@@ -0,0 +1,48 @@
+// internal/auth/totp_test.go
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// Test vectors from RFC 6238 Appendix B (SHA1, 8 digits).
+func TestTOTPCodeRFC6238(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	cases := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, c := range cases {
+		if got := totpCode(secret, time.Unix(c.unix, 0), 8); got != c.want {
+			t.Errorf("T=%d: got %s, want %s", c.unix, got, c.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := b32.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111111, 0)
+	code := totpCode([]byte("12345678901234567890"), now, totpDigits)
+
+	step, ok := validateTOTP(secret, code, now, 0)
+	if !ok || step != totpStep(now) {
+		t.Fatalf("valid code rejected: step=%d ok=%v", step, ok)
+	}
+	if _, ok := validateTOTP(secret, code, now.Add(totpPeriod*time.Second), 0); !ok {
+		t.Error("code from previous step should be accepted within skew")
+	}
+	if _, ok := validateTOTP(secret, code, now.Add(5*totpPeriod*time.Second), 0); ok {
+		t.Error("stale code accepted")
+	}
+	if _, ok := validateTOTP(secret, code, now, step); ok {
+		t.Error("replayed code accepted")
+	}
+}
@@ -0,0 +1,71 @@
+// internal/billing/handler.go
+package billing
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"stringmeup/backend/internal/db"
+	"stringmeup/backend/internal/middleware"
+)
+
+// RegisterWebhookRoutes mounts the provider webhooks, which authenticate
+// by signature rather than as a user.
+func RegisterWebhookRoutes(r chi.Router, svc *Service) {
+	r.Post("/billing/webhooks/{provider}", handleWebhook(svc))
+}
+
+func RegisterRoutes(r chi.Router, svc *Service) {
+	r.With(middleware.RequireScopes(middleware.ScopeProfileRead)).Get("/billing/plan", handlePlan(svc))
+}
+
+func handlePlan(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := middleware.UserID(r)
+		plan, err := svc.PlanFor(r.Context(), userID)
+		if err != nil {
+			db.Error(w, http.StatusInternalServerError, "SERVER_ERROR", err.Error())
+			return
+		}
+		sub, err := svc.Subscription(r.Context(), userID)
+		if err != nil {
+			db.Error(w, http.StatusInternalServerError, "SERVER_ERROR", err.Error())
+			return
+		}
+		db.Data(w, http.StatusOK, map[string]any{"plan": plan, "subscription": sub})
+	}
+}
+
+func handleWebhook(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := svc.HandleWebhook(r.Context(), chi.URLParam(r, "provider"), r)
+		switch {
+		case errors.Is(err, ErrUnknownProvider):
+			db.Error(w, http.StatusNotFound, "NOT_FOUND", err.Error())
+		case errors.Is(err, ErrInvalidSignature):
+			db.Error(w, http.StatusUnauthorized, "UNAUTHORIZED", err.Error())
+		case errors.Is(err, ErrInvalidEvent):
+			db.Error(w, http.StatusBadRequest, "VALIDATION_ERROR", err.Error())
+		case err != nil:
+			// Providers retry on 5xx, which is what we want for transient failures
+			log.Printf("billing: webhook: %v", err)
+			db.Error(w, http.StatusInternalServerError, "SERVER_ERROR", "could not process event")
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
+
+// WriteLimitError writes a 402 if err is a plan limit and reports whether
+// it did.
+func WriteLimitError(w http.ResponseWriter, err error) bool {
+	var limit *LimitError
+	if !errors.As(err, &limit) {
+		return false
+	}
+	db.ErrorWith(w, http.StatusPaymentRequired, "PLAN_LIMIT", limit.Error(),
+		map[string]any{"limit": limit.Limit, "plan": limit.Plan})
+	return true
+}
@@ -0,0 +1,79 @@
+// internal/billing/plans.go
+package billing
+
+import "fmt"
+
+// Plan is a tier and the limits that come with it. Zero limits mean
+// unlimited.
+type Plan struct {
+	ID                string `json:"id"`
+	Name              string `json:"name"`
+	MaxActiveProjects int    `json:"max_active_projects"`
+	MaxNailCount      int    `json:"max_nail_count"`
+	LayerMode         bool   `json:"layer_mode"`
+	StorageBytes      int64  `json:"storage_bytes"`
+	MaxUploadBytes    int64  `json:"max_upload_bytes"`
+}
+
+const (
+	PlanFree = "free"
+	PlanPro  = "pro"
+)
+
+var Plans = map[string]Plan{
+	PlanFree: {
+		ID:                PlanFree,
+		Name:              "Free",
+		MaxActiveProjects: 3,
+		MaxNailCount:      200,
+		LayerMode:         false,
+		StorageBytes:      100 << 20,
+		MaxUploadBytes:    10 << 20,
+	},
+	PlanPro: {
+		ID:                PlanPro,
+		Name:              "Pro",
+		MaxActiveProjects: 0,
+		MaxNailCount:      500,
+		LayerMode:         true,
+		StorageBytes:      5 << 30,
+		MaxUploadBytes:    25 << 20,
+	},
+}
+
+// LimitError reports which limit of the user's plan a request would exceed.
+type LimitError struct {
+	Plan  string
+	Limit string
+	Max   int64
+}
+
+func (e *LimitError) Error() string {
+	if e.Max == 0 {
+		return fmt.Sprintf("%s is not included in the %s plan", e.Limit, e.Plan)
+	}
+	return fmt.Sprintf("the %s plan allows at most %d for %s", e.Plan, e.Max, e.Limit)
+}
+
+// CheckProject checks an active project against the plan. activeProjects
+// counts the user's other active projects.
+func (p Plan) CheckProject(activeProjects, nailCount int, layerMode bool) error {
+	if p.MaxActiveProjects > 0 && activeProjects >= p.MaxActiveProjects {
+		return &LimitError{Plan: p.ID, Limit: "active_projects", Max: int64(p.MaxActiveProjects)}
+	}
+	if p.MaxNailCount > 0 && nailCount > p.MaxNailCount {
+		return &LimitError{Plan: p.ID, Limit: "nail_count", Max: int64(p.MaxNailCount)}
+	}
+	if layerMode && !p.LayerMode {
+		return &LimitError{Plan: p.ID, Limit: "layer_mode"}
+	}
+	return nil
+}
+
+// CheckUpload checks the size of a single upload.
+func (p Plan) CheckUpload(size int64) error {
+	if p.MaxUploadBytes > 0 && size > p.MaxUploadBytes {
+		return &LimitError{Plan: p.ID, Limit: "upload_bytes", Max: p.MaxUploadBytes}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+// internal/billing/service.go
+package billing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"stringmeup/backend/internal/config"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown billing provider")
+	ErrInvalidEvent    = errors.New("invalid billing event")
+)
+
+type Subscription struct {
+	Provider         string     `json:"provider"`
+	Plan             string     `json:"plan"`
+	Status           string     `json:"status"`
+	CurrentPeriodEnd *time.Time `json:"current_period_end"`
+}
+
+type Service struct {
+	db        *pgxpool.Pool
+	cfg       *config.Config
+	providers map[string]Provider
+}
+
+func NewService(db *pgxpool.Pool, cfg *config.Config, providers ...Provider) *Service {
+	s := &Service{db: db, cfg: cfg, providers: map[string]Provider{}}
+	for _, p := range providers {
+		s.providers[p.Name()] = p
+	}
+	return s
+}
+
+// PlanFor returns the plan the user is entitled to right now. A canceled
+// subscription keeps its plan until the period already paid for ends.
+func (s *Service) PlanFor(ctx context.Context, userID string) (Plan, error) {
+	sub, err := s.Subscription(ctx, userID)
+	if err != nil {
+		return Plan{}, err
+	}
+	if sub == nil || !sub.entitled(time.Now()) {
+		return s.plan(PlanFree), nil
+	}
+	return s.plan(sub.Plan), nil
+}
+
+// plan applies configured quota overrides to a plan.
+func (s *Service) plan(id string) Plan {
+	p := Plans[id]
+	if q, ok := s.cfg.StorageQuotas[id]; ok {
+		p.StorageBytes = q
+	}
+	return p
+}
+
+func (sub *Subscription) entitled(now time.Time) bool {
+	if _, ok := Plans[sub.Plan]; !ok {
+		return false
+	}
+	switch sub.Status {
+	case "active", "trialing", "past_due":
+		return true
+	}
+	return sub.CurrentPeriodEnd != nil && sub.CurrentPeriodEnd.After(now)
+}
+
+// Subscription returns the user's subscription, or nil if they never had one.
+func (s *Service) Subscription(ctx context.Context, userID string) (*Subscription, error) {
+	sub := &Subscription{}
+	err := s.db.QueryRow(ctx,
+		`SELECT provider, plan, status, current_period_end
+		 FROM subscriptions WHERE user_id = $1`, userID,
+	).Scan(&sub.Provider, &sub.Plan, &sub.Status, &sub.CurrentPeriodEnd)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load subscription: %w", err)
+	}
+	return sub, nil
+}
+
+// HandleWebhook verifies a webhook with the named provider and applies it.
+// Events are recorded by ID in the same transaction, so redeliveries are
+// no-ops.
+func (s *Service) HandleWebhook(ctx context.Context, provider string, r *http.Request) error {
+	p, ok := s.providers[provider]
+	if !ok {
+		return ErrUnknownProvider
+	}
+	e, err := p.ParseWebhook(r)
+	if err != nil {
+		return err
+	}
+	if e.ID == "" || e.SubscriptionID == "" {
+		return ErrInvalidEvent
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx,
+		`INSERT INTO billing_events (provider, event_id, type) VALUES ($1, $2, $3)
+		 ON CONFLICT DO NOTHING`, provider, e.ID, e.Type)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+
+	switch e.Type {
+	case EventSubscriptionUpdated:
+		if _, ok := Plans[e.Plan]; !ok || e.Status == "" {
+			return ErrInvalidEvent
+		}
+		if e.UserID == "" {
+			tag, err = tx.Exec(ctx,
+				`UPDATE subscriptions
+				 SET plan = $1, status = $2, current_period_end = $3, updated_at = NOW()
+				 WHERE provider = $4 AND subscription_id = $5`,
+				e.Plan, e.Status, e.CurrentPeriodEnd, provider, e.SubscriptionID)
+		} else {
+			tag, err = tx.Exec(ctx,
+				`INSERT INTO subscriptions
+				   (user_id, provider, customer_id, subscription_id, plan, status, current_period_end)
+				 VALUES ($1, $2, $3, $4, $5, $6, $7)
+				 ON CONFLICT (user_id) DO UPDATE SET
+				   provider = EXCLUDED.provider, customer_id = EXCLUDED.customer_id,
+				   subscription_id = EXCLUDED.subscription_id, plan = EXCLUDED.plan,
+				   status = EXCLUDED.status, current_period_end = EXCLUDED.current_period_end,
+				   updated_at = NOW()`,
+				e.UserID, provider, e.CustomerID, e.SubscriptionID, e.Plan, e.Status, e.CurrentPeriodEnd)
+		}
+	case EventSubscriptionCanceled:
+		tag, err = tx.Exec(ctx,
+			`UPDATE subscriptions
+			 SET status = 'canceled', current_period_end = COALESCE($1, current_period_end), updated_at = NOW()
+			 WHERE provider = $2 AND subscription_id = $3`,
+			e.CurrentPeriodEnd, provider, e.SubscriptionID)
+	default:
+		// Recorded so it isn't redelivered forever, but nothing to apply
+		return tx.Commit(ctx)
+	}
+	if err != nil {
+		return fmt.Errorf("apply %s: %w", e.Type, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrInvalidEvent
+	}
+	return tx.Commit(ctx)
+}
@@ -3,7 +3,11 @@ package config
 
 import (
 	"log"
+	"net"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -11,13 +15,52 @@ import (
 type Config struct {
 	Port        string
 	DatabaseURL string
-	JWTSecret   string
-	// Cloudflare R2
+	// JWT signing keys
+	JWTRotateEvery time.Duration // how often a new signing key is generated
+	JWTRetireAfter time.Duration // how long a replaced key keeps verifying
+	JWTSecret      string        // legacy HS256 secret, verify-only; unset once old tokens expire
+	// StorageBackend is "r2", "local" or "memory". The local backends keep
+	// objects on this machine and serve presigned URLs from StorageURL,
+	// signed with StorageSigningSecret (random per process if unset).
+	// StoragePrivate keeps objects private and hands out presigned GET URLs
+	// instead of public ones.
+	StorageBackend       string
+	StoragePrivate       bool
+	LocalStorageDir      string
+	StorageURL           string
+	StorageSigningSecret string
+	// Unreferenced images older than UploadGCGrace are collected every
+	// UploadGCInterval; with UploadGCDryRun they are only reported
+	UploadGCInterval time.Duration
+	UploadGCGrace    time.Duration
+	UploadGCDryRun   bool
+	// Cloudflare R2, required when StorageBackend is "r2"
 	R2AccountID       string
 	R2AccessKeyID     string
 	R2SecretAccessKey string
 	R2BucketName      string
 	R2PublicURL       string // e.g. https://pub-xxx.r2.dev
+	// Outgoing mail; logged instead of sent when SMTPHost is empty
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	MailFrom     string
+	// AppURL is where links in emails point, e.g. https://app.threadcraft.io
+	AppURL string
+	// AccountDeletionGrace is how long a deleted account can still be
+	// restored by logging in
+	AccountDeletionGrace time.Duration
+	// StorageQuotas overrides plans' storage quotas in bytes, keyed by
+	// plan ID
+	StorageQuotas map[string]int64
+	// BillingFakeSecret enables the fake billing provider for local
+	// development; webhooks to it must be signed with this secret
+	BillingFakeSecret string
+	// TrustedProxies are the networks whose X-Forwarded-For and X-Real-IP
+	// headers are believed. Requests from anywhere else are identified by
+	// their socket address.
+	TrustedProxies []*net.IPNet
 }
 
 func Load() *Config {
@@ -26,16 +69,45 @@ func Load() *Config {
 		log.Println("no .env file, using environment variables")
 	}
 
-	return &Config{
-		Port:              getEnv("PORT", "8080"),
-		DatabaseURL:       mustEnv("DATABASE_URL"),
-		JWTSecret:         mustEnv("JWT_SECRET"),
-		R2AccountID:       mustEnv("R2_ACCOUNT_ID"),
-		R2AccessKeyID:     mustEnv("R2_ACCESS_KEY_ID"),
-		R2SecretAccessKey: mustEnv("R2_SECRET_ACCESS_KEY"),
-		R2BucketName:      mustEnv("R2_BUCKET_NAME"),
-		R2PublicURL:       mustEnv("R2_PUBLIC_URL"),
+	cfg := &Config{
+		Port:                 getEnv("PORT", "8080"),
+		DatabaseURL:          mustEnv("DATABASE_URL"),
+		JWTSecret:            getEnv("JWT_SECRET", ""),
+		JWTRotateEvery:       getDuration("JWT_KEY_ROTATE_EVERY", 30*24*time.Hour),
+		JWTRetireAfter:       getDuration("JWT_KEY_RETIRE_AFTER", 24*time.Hour),
+		StorageBackend:       getEnv("STORAGE_BACKEND", "r2"),
+		LocalStorageDir:      getEnv("LOCAL_STORAGE_DIR", "./data/storage"),
+		StorageSigningSecret: getEnv("STORAGE_SIGNING_SECRET", ""),
+		StoragePrivate:       getEnv("STORAGE_PRIVATE", "") == "true",
+		UploadGCInterval:     getDuration("UPLOAD_GC_INTERVAL", 6*time.Hour),
+		UploadGCGrace:        getDuration("UPLOAD_GC_GRACE", 72*time.Hour),
+		UploadGCDryRun:       getEnv("UPLOAD_GC_DRY_RUN", "") == "true",
+		SMTPHost:             getEnv("SMTP_HOST", ""),
+		SMTPPort:             getEnv("SMTP_PORT", "587"),
+		SMTPUsername:         getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:         getEnv("SMTP_PASSWORD", ""),
+		MailFrom:             getEnv("MAIL_FROM", "ThreadCraft <no-reply@threadcraft.app>"),
+		AppURL:               getEnv("APP_URL", "http://localhost:8080"),
+		AccountDeletionGrace: getDuration("ACCOUNT_DELETION_GRACE", 30*24*time.Hour),
+		BillingFakeSecret:    getEnv("BILLING_FAKE_SECRET", ""),
+		StorageQuotas:        getQuotas("STORAGE_QUOTAS"),
+		TrustedProxies:       getCIDRs("TRUSTED_PROXIES"),
 	}
+	cfg.StorageURL = getEnv("STORAGE_URL", "http://localhost:"+cfg.Port+"/storage")
+	if cfg.StorageBackend == "r2" {
+		cfg.R2AccountID = mustEnv("R2_ACCOUNT_ID")
+		cfg.R2AccessKeyID = mustEnv("R2_ACCESS_KEY_ID")
+		cfg.R2SecretAccessKey = mustEnv("R2_SECRET_ACCESS_KEY")
+		cfg.R2BucketName = mustEnv("R2_BUCKET_NAME")
+		// Private buckets have no public URL, but keeping it lets links
+		// stored before the switch be re-signed
+		if cfg.StoragePrivate {
+			cfg.R2PublicURL = getEnv("R2_PUBLIC_URL", "")
+		} else {
+			cfg.R2PublicURL = mustEnv("R2_PUBLIC_URL")
+		}
+	}
+	return cfg
 }
 
 func getEnv(key, fallback string) string {
@@ -52,3 +124,69 @@ func mustEnv(key string) string {
 	}
 	return v
 }
+
+func getDuration(key string, fallback time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Fatalf("env var %q: %v", key, err)
+	}
+	return d
+}
+
+// getQuotas parses a list such as "free=200MB,pro=10GB". Sizes are whole
+// numbers with an optional KB, MB or GB suffix, in powers of 1024.
+func getQuotas(key string) map[string]int64 {
+	quotas := map[string]int64{}
+	v := os.Getenv(key)
+	if v == "" {
+		return quotas
+	}
+	for _, item := range strings.Split(v, ",") {
+		plan, size, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok {
+			log.Fatalf("env var %q: %q is not plan=size", key, item)
+		}
+		shift := 0
+		for suffix, s := range map[string]int{"KB": 10, "MB": 20, "GB": 30} {
+			if n, found := strings.CutSuffix(strings.ToUpper(size), suffix); found {
+				size, shift = n, s
+			}
+		}
+		n, err := strconv.ParseInt(size, 10, 64)
+		if err != nil || n < 0 {
+			log.Fatalf("env var %q: invalid size for %s", key, plan)
+		}
+		quotas[plan] = n << shift
+	}
+	return quotas
+}
+
+// getCIDRs parses a list such as "10.0.0.0/8,fd00::/8". A bare address
+// stands for just itself.
+func getCIDRs(key string) []*net.IPNet {
+	var nets []*net.IPNet
+	v := os.Getenv(key)
+	if v == "" {
+		return nets
+	}
+	for _, item := range strings.Split(v, ",") {
+		item = strings.TrimSpace(item)
+		if !strings.Contains(item, "/") {
+			if ip := net.ParseIP(item); ip != nil && ip.To4() != nil {
+				item += "/32"
+			} else {
+				item += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(item)
+		if err != nil {
+			log.Fatalf("env var %q: %v", key, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
@@ -0,0 +1,40 @@
+// internal/dataexport/handler.go
+package dataexport
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"stringmeup/backend/internal/db"
+	"stringmeup/backend/internal/middleware"
+)
+
+func RegisterRoutes(r chi.Router, svc *Service) {
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.RequireSession)
+		r.Post("/users/me/export", handleRequest(svc))
+		r.Get("/users/me/export/{id}", handleGet(svc))
+	})
+}
+
+func handleRequest(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		e, err := svc.Request(r.Context(), middleware.UserID(r))
+		if err != nil {
+			db.Error(w, http.StatusInternalServerError, "SERVER_ERROR", err.Error())
+			return
+		}
+		db.Data(w, http.StatusAccepted, e)
+	}
+}
+
+func handleGet(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		e, err := svc.Get(r.Context(), chi.URLParam(r, "id"), middleware.UserID(r))
+		if err != nil {
+			db.Error(w, http.StatusNotFound, "NOT_FOUND", "export not found")
+			return
+		}
+		db.Data(w, http.StatusOK, e)
+	}
+}
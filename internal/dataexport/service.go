@@ -0,0 +1,387 @@
+// internal/dataexport/service.go
+package dataexport
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"stringmeup/backend/internal/i18n"
+	"stringmeup/backend/internal/mail"
+	"stringmeup/backend/internal/notifications"
+	"stringmeup/backend/internal/progress"
+	"stringmeup/backend/internal/projects"
+	"stringmeup/backend/internal/uploads"
+	"stringmeup/backend/internal/users"
+)
+
+// Download links are presigned S3 URLs, which can't outlive seven days.
+const linkTTL = 7 * 24 * time.Hour
+
+type Export struct {
+	ID          string     `json:"id"`
+	Status      string     `json:"status"`
+	SizeBytes   int64      `json:"size_bytes"`
+	Error       string     `json:"error,omitempty"`
+	DownloadURL string     `json:"download_url,omitempty"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+
+	userID    string
+	objectKey string
+	locale    string
+}
+
+type Service struct {
+	db       *pgxpool.Pool
+	users    *users.Service
+	projects *projects.Service
+	progress *progress.Service
+	uploads  *uploads.Service
+	mailer   mail.Mailer
+	notify   *notifications.Service
+	wake     chan struct{}
+}
+
+func NewService(db *pgxpool.Pool, users *users.Service, projects *projects.Service,
+	progress *progress.Service, uploads *uploads.Service, mailer mail.Mailer,
+	notify *notifications.Service) *Service {
+	return &Service{
+		db:       db,
+		users:    users,
+		projects: projects,
+		progress: progress,
+		uploads:  uploads,
+		mailer:   mailer,
+		notify:   notify,
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Request queues an export for the user, or returns the one already queued.
+func (s *Service) Request(ctx context.Context, userID string) (*Export, error) {
+	if e, err := s.scanOne(s.db.QueryRow(ctx,
+		`SELECT id, user_id, status, object_key, size_bytes, error, locale, completed_at, expires_at, created_at
+		 FROM data_exports
+		 WHERE user_id = $1 AND status IN ('pending', 'processing')
+		 ORDER BY created_at DESC LIMIT 1`, userID)); err == nil {
+		return e, nil
+	}
+
+	e := &Export{ID: uuid.New().String(), Status: "pending", CreatedAt: time.Now().UTC()}
+	_, err := s.db.Exec(ctx,
+		`INSERT INTO data_exports (id, user_id, status, locale, created_at) VALUES ($1, $2, $3, $4, $5)`,
+		e.ID, userID, e.Status, i18n.FromContext(ctx), e.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("insert export: %w", err)
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return e, nil
+}
+
+// Get returns an export with a fresh download link if it is ready.
+func (s *Service) Get(ctx context.Context, id, userID string) (*Export, error) {
+	e, err := s.scanOne(s.db.QueryRow(ctx,
+		`SELECT id, user_id, status, object_key, size_bytes, error, locale, completed_at, expires_at, created_at
+		 FROM data_exports WHERE id = $1 AND user_id = $2`, id, userID))
+	if err != nil {
+		return nil, fmt.Errorf("export not found")
+	}
+	if e.Status == "ready" {
+		ttl := time.Until(*e.ExpiresAt)
+		if e.DownloadURL, err = s.uploads.PresignGet(ctx, e.objectKey, ttl); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+func (s *Service) scanOne(row pgx.Row) (*Export, error) {
+	e := &Export{}
+	err := row.Scan(&e.ID, &e.userID, &e.Status, &e.objectKey, &e.SizeBytes, &e.Error, &e.locale,
+		&e.CompletedAt, &e.ExpiresAt, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Run builds queued exports and expires old ones until ctx is cancelled.
+// Claiming with SKIP LOCKED lets several instances share the queue.
+func (s *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		for {
+			e, err := s.claim(ctx)
+			if err != nil {
+				if !errors.Is(err, pgx.ErrNoRows) {
+					log.Printf("dataexport: claim: %v", err)
+				}
+				break
+			}
+			s.process(ctx, e)
+		}
+		if err := s.expire(ctx); err != nil {
+			log.Printf("dataexport: expire: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// claim picks the oldest pending export. Exports stuck in processing for
+// an hour belonged to an instance that died and are retried.
+func (s *Service) claim(ctx context.Context) (*Export, error) {
+	return s.scanOne(s.db.QueryRow(ctx,
+		`UPDATE data_exports SET status = 'processing', started_at = NOW()
+		 WHERE id = (
+		   SELECT id FROM data_exports
+		   WHERE status = 'pending'
+		      OR (status = 'processing' AND started_at < NOW() - INTERVAL '1 hour')
+		   ORDER BY created_at LIMIT 1
+		   FOR UPDATE SKIP LOCKED)
+		 RETURNING id, user_id, status, object_key, size_bytes, error, locale, completed_at, expires_at, created_at`))
+}
+
+func (s *Service) process(ctx context.Context, e *Export) {
+	user, err := s.users.GetByID(ctx, e.userID)
+	if err != nil {
+		s.fail(ctx, e, err)
+		return
+	}
+
+	key := fmt.Sprintf("users/%s/exports/%s.zip", e.userID, e.ID)
+	size, err := s.build(ctx, user, key)
+	if err != nil {
+		s.fail(ctx, e, err)
+		return
+	}
+
+	expiresAt := time.Now().UTC().Add(linkTTL)
+	_, err = s.db.Exec(ctx,
+		`UPDATE data_exports
+		 SET status = 'ready', object_key = $1, size_bytes = $2,
+		     completed_at = NOW(), expires_at = $3
+		 WHERE id = $4`, key, size, expiresAt, e.ID)
+	if err != nil {
+		s.fail(ctx, e, err)
+		return
+	}
+
+	s.notify.Notify(ctx, e.userID, notifications.KindExportReady, "notification.export_ready",
+		[]any{expiresAt}, map[string]any{"export_id": e.ID})
+
+	link, err := s.uploads.PresignGet(ctx, key, linkTTL)
+	if err != nil {
+		log.Printf("dataexport: presign %s: %v", e.ID, err)
+		return
+	}
+	err = s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: i18n.T(e.locale, "email.export_ready.subject"),
+		Text: i18n.T(e.locale, "email.export_ready.body",
+			user.Name, link, i18n.Date(e.locale, expiresAt)),
+	})
+	if err != nil {
+		log.Printf("dataexport: notify %s: %v", e.ID, err)
+	}
+}
+
+func (s *Service) fail(ctx context.Context, e *Export, cause error) {
+	log.Printf("dataexport: build %s: %v", e.ID, cause)
+	s.db.Exec(ctx,
+		`UPDATE data_exports SET status = 'failed', error = $1, completed_at = NOW() WHERE id = $2`,
+		"export could not be built", e.ID)
+}
+
+// expire removes archives whose download window has closed.
+func (s *Service) expire(ctx context.Context) error {
+	rows, err := s.db.Query(ctx,
+		`SELECT id, object_key FROM data_exports
+		 WHERE status = 'ready' AND expires_at < NOW()`)
+	if err != nil {
+		return err
+	}
+	type expired struct{ id, key string }
+	var list []expired
+	for rows.Next() {
+		var x expired
+		if err := rows.Scan(&x.id, &x.key); err != nil {
+			rows.Close()
+			return err
+		}
+		list = append(list, x)
+	}
+	rows.Close()
+
+	for _, x := range list {
+		if err := s.uploads.Delete(ctx, x.key); err != nil {
+			return err
+		}
+		s.db.Exec(ctx, `UPDATE data_exports SET status = 'expired' WHERE id = $1`, x.id)
+	}
+	return rows.Err()
+}
+
+// build writes the archive to a temp file, then uploads it to key.
+func (s *Service) build(ctx context.Context, user *users.User, key string) (int64, error) {
+	f, err := os.CreateTemp("", "export-*.zip")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	if err := s.writeArchive(ctx, zw, user); err != nil {
+		return 0, err
+	}
+	if err := zw.Close(); err != nil {
+		return 0, err
+	}
+
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	if err := s.uploads.Put(ctx, key, "application/zip", f, size); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+type session struct {
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (s *Service) writeArchive(ctx context.Context, zw *zip.Writer, user *users.User) error {
+	if err := writeJSON(zw, "profile.json", user); err != nil {
+		return err
+	}
+
+	sessions, err := s.sessions(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(zw, "sessions.json", sessions); err != nil {
+		return err
+	}
+
+	for page := 1; ; page++ {
+		list, meta, err := s.projects.List(ctx, user.ID, page, 100)
+		if err != nil {
+			return fmt.Errorf("list projects: %w", err)
+		}
+		for i := range list {
+			if err := s.writeProject(ctx, zw, user.ID, &list[i]); err != nil {
+				return err
+			}
+		}
+		if page*meta.Limit >= meta.Total {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *Service) writeProject(ctx context.Context, zw *zip.Writer, userID string, p *projects.Project) error {
+	dir := "projects/" + p.ID + "/"
+	if err := writeJSON(zw, dir+"project.json", p); err != nil {
+		return err
+	}
+	w, err := zw.Create(dir + "string_plan.json")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, p.StringPlanJSON); err != nil {
+		return err
+	}
+
+	prog, err := s.progress.Get(ctx, p.ID, userID)
+	if err != nil {
+		return fmt.Errorf("progress %s: %w", p.ID, err)
+	}
+	if err := writeJSON(zw, dir+"progress.json", prog); err != nil {
+		return err
+	}
+
+	key, ok := s.uploads.StoredKey(userID, p.ImageRef())
+	if !ok {
+		return nil
+	}
+	body, err := s.uploads.Get(ctx, key)
+	if err != nil {
+		// An image that was never uploaded shouldn't sink the whole export
+		log.Printf("dataexport: image for project %s: %v", p.ID, err)
+		return nil
+	}
+	defer body.Close()
+	// Upload keys have no extension; older image URLs may
+	ext := path.Ext(key)
+	if p.ImageUploadID != nil {
+		if u, err := s.uploads.Owned(ctx, *p.ImageUploadID, userID); err == nil {
+			ext = uploads.Extension(u.ContentType)
+		}
+	}
+	w, err = zw.Create(dir + "image" + ext)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, body)
+	return err
+}
+
+func (s *Service) sessions(ctx context.Context, userID string) ([]session, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT created_at, expires_at FROM refresh_tokens
+		 WHERE user_id = $1 ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []session{}
+	for rows.Next() {
+		var se session
+		if err := rows.Scan(&se.CreatedAt, &se.ExpiresAt); err != nil {
+			return nil, err
+		}
+		list = append(list, se)
+	}
+	return list, rows.Err()
+}
+
+func writeJSON(zw *zip.Writer, name string, v any) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
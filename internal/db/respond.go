@@ -4,6 +4,8 @@ package db
 import (
 	"encoding/json"
 	"net/http"
+
+	"stringmeup/backend/internal/i18n"
 )
 
 func JSON(w http.ResponseWriter, status int, v any) {
@@ -13,12 +15,38 @@ func JSON(w http.ResponseWriter, status int, v any) {
 }
 
 func Error(w http.ResponseWriter, status int, code, message string) {
-	JSON(w, status, map[string]any{
-		"error": map[string]string{
-			"code":    code,
-			"message": message,
-		},
-	})
+	ErrorWith(w, status, code, message, nil)
+}
+
+// ErrorWith is Error with extra fields added to the error object.
+func ErrorWith(w http.ResponseWriter, status int, code, message string, extra map[string]any) {
+	body := localize(w, code, message)
+	for k, v := range extra {
+		body[k] = v
+	}
+	JSON(w, status, map[string]any{"error": body})
+}
+
+// FieldErrors writes a 422 listing why each named field was rejected.
+func FieldErrors(w http.ResponseWriter, fields map[string]string) {
+	ErrorWith(w, http.StatusUnprocessableEntity, "VALIDATION_ERROR",
+		"one or more fields are invalid", map[string]any{"fields": fields})
+}
+
+// localize builds the error object in the response's Content-Language.
+// Messages are written in English at the call site; other locales get the
+// catalog message for the code, with the English kept as detail.
+func localize(w http.ResponseWriter, code, message string) map[string]any {
+	body := map[string]any{"code": code, "message": message}
+	loc := w.Header().Get("Content-Language")
+	if loc == "" || loc == i18n.Default {
+		return body
+	}
+	if msg, ok := i18n.Lookup(loc, "error."+code); ok {
+		body["message"] = msg
+		body["detail"] = message
+	}
+	return body
 }
 
 func Data(w http.ResponseWriter, status int, data any) {
@@ -0,0 +1,79 @@
+// internal/i18n/i18n.go
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Default is the fallback locale. Every key must exist in it.
+const Default = "en"
+
+//go:embed locales/*.json
+var localeFS embed.FS
+
+// catalogs maps locale to message key to message. Messages are fmt
+// formats; their verbs must match across locales.
+var catalogs = map[string]map[string]string{}
+
+func init() {
+	files, err := localeFS.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	for _, f := range files {
+		data, err := localeFS.ReadFile("locales/" + f.Name())
+		if err != nil {
+			panic(err)
+		}
+		msgs := map[string]string{}
+		if err := json.Unmarshal(data, &msgs); err != nil {
+			panic(fmt.Sprintf("i18n: %s: %v", f.Name(), err))
+		}
+		catalogs[strings.TrimSuffix(f.Name(), path.Ext(f.Name()))] = msgs
+	}
+	if catalogs[Default] == nil {
+		panic("i18n: missing default locale " + Default)
+	}
+}
+
+// Supported returns the shipped locales, sorted.
+func Supported() []string {
+	list := make([]string, 0, len(catalogs))
+	for loc := range catalogs {
+		list = append(list, loc)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Lookup returns the message for key in locale, without falling back.
+func Lookup(locale, key string) (string, bool) {
+	msg, ok := catalogs[locale][key]
+	return msg, ok
+}
+
+// T formats the message for key in locale, falling back to the default
+// locale and then to the key itself.
+func T(locale, key string, args ...any) string {
+	msg, ok := Lookup(locale, key)
+	if !ok {
+		if msg, ok = Lookup(Default, key); !ok {
+			return key
+		}
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+// Date formats t as a date in locale's usual style.
+func Date(locale string, t time.Time) string {
+	return t.Format(T(locale, "date.layout"))
+}
@@ -0,0 +1,48 @@
+// internal/i18n/i18n_test.go
+package i18n
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+)
+
+var verbRe = regexp.MustCompile(`%[-+# 0]*[0-9]*(\.[0-9]+)?[a-zA-Z%]`)
+
+func TestCatalogsComplete(t *testing.T) {
+	for _, loc := range Supported() {
+		for key, want := range catalogs[Default] {
+			got, ok := catalogs[loc][key]
+			if !ok {
+				t.Errorf("%s: missing %q", loc, key)
+				continue
+			}
+			if w, g := verbRe.FindAllString(want, -1), verbRe.FindAllString(got, -1); !slices.Equal(w, g) {
+				t.Errorf("%s: %q has verbs %v, want %v", loc, key, g, w)
+			}
+		}
+		for key := range catalogs[loc] {
+			if _, ok := catalogs[Default][key]; !ok {
+				t.Errorf("%s: %q is not in %s", loc, key, Default)
+			}
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	cases := map[string]string{
+		"":                        Default,
+		"de":                      "de",
+		"fr-CA,fr;q=0.9,en;q=0.8": "fr",
+		"ja,es;q=0.5":             "es",
+		"en;q=0.2,de;q=0.9":       "de",
+		"es;q=0":                  Default,
+		"*":                       Default,
+		"pt-BR, ES-mx;q=0.7":      "es",
+	}
+	for header, want := range cases {
+		if got := Negotiate(header); got != want {
+			t.Errorf("Negotiate(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
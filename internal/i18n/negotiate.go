@@ -0,0 +1,102 @@
+// internal/i18n/negotiate.go
+package i18n
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type contextKey struct{}
+
+// WithLocale returns ctx carrying locale.
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, contextKey{}, locale)
+}
+
+// FromContext returns the locale negotiated for the request, or Default.
+func FromContext(ctx context.Context) string {
+	if loc, ok := ctx.Value(contextKey{}).(string); ok {
+		return loc
+	}
+	return Default
+}
+
+// Resolve returns preferred if it is a supported locale, and otherwise the
+// locale negotiated for the request in ctx.
+func Resolve(ctx context.Context, preferred string) string {
+	if _, ok := catalogs[preferred]; ok {
+		return preferred
+	}
+	return FromContext(ctx)
+}
+
+// Negotiate picks the best supported locale for an Accept-Language header.
+// A regional tag like fr-CA matches its base language.
+func Negotiate(header string) string {
+	type pref struct {
+		tag string
+		q   float64
+	}
+	var prefs []pref
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if q > 0 {
+			prefs = append(prefs, pref{strings.ToLower(tag), q})
+		}
+	}
+	sort.SliceStable(prefs, func(i, j int) bool { return prefs[i].q > prefs[j].q })
+
+	for _, p := range prefs {
+		if p.tag == "*" {
+			return Default
+		}
+		base, _, _ := strings.Cut(p.tag, "-")
+		if _, ok := catalogs[p.tag]; ok {
+			return p.tag
+		}
+		if _, ok := catalogs[base]; ok {
+			return base
+		}
+	}
+	return Default
+}
+
+// Middleware negotiates the locale from Accept-Language. The choice is
+// stored in the request context and echoed as Content-Language, which is
+// where db.Error reads it from.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		loc := Negotiate(r.Header.Get("Accept-Language"))
+		w.Header().Set("Content-Language", loc)
+		next.ServeHTTP(w, r.WithContext(WithLocale(r.Context(), loc)))
+	})
+}
+
+// Prefer overrides the negotiated locale with the one preferred returns,
+// when that is non-empty and supported. It runs after authentication so
+// preferred can consult the user's settings.
+func Prefer(preferred func(r *http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if loc := preferred(r); loc != "" {
+				if _, ok := catalogs[loc]; ok {
+					w.Header().Set("Content-Language", loc)
+					r = r.WithContext(WithLocale(r.Context(), loc))
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,239 @@
+// internal/imaging/adjust.go
+package imaging
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// AdjustVersion changes whenever Adjust would produce different pixels for
+// the same input, so copies made by an older pipeline aren't reused.
+const AdjustVersion = 1
+
+// Adjustments are the framing and tone changes a user makes to an image
+// before it becomes a working copy. The zero value changes nothing.
+type Adjustments struct {
+	Crop *Crop `json:"crop,omitempty"`
+	// Degrees clockwise, applied before cropping. The canvas grows to
+	// fit and the corners it gains are white.
+	Rotation float64 `json:"rotation"`
+	// Brightness and Contrast run from -1 to 1, 0 leaving the image as is
+	Brightness float64 `json:"brightness"`
+	Contrast   float64 `json:"contrast"`
+	// Gamma runs from 0.1 to 10, higher values lightening the midtones;
+	// 0 is the same as 1
+	Gamma  float64 `json:"gamma"`
+	Invert bool    `json:"invert"`
+	// EdgeEmphasis runs from 0 to 1 and sharpens outlines, which strings
+	// pick out better than gradients
+	EdgeEmphasis float64 `json:"edge_emphasis"`
+}
+
+// Crop is a rectangle in fractions of the rotated image's width and
+// height. A circle crop keeps the largest circle centred in it.
+type Crop struct {
+	Shape  string  `json:"shape"` // rect | circle
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// IsZero reports whether a leaves images unchanged.
+func (a *Adjustments) IsZero() bool {
+	return a.Crop == nil && a.Rotation == 0 && a.Brightness == 0 && a.Contrast == 0 &&
+		(a.Gamma == 0 || a.Gamma == 1) && !a.Invert && a.EdgeEmphasis == 0
+}
+
+// Validate returns why each invalid field was rejected, keyed by its JSON
+// path, e.g. "crop.width".
+func (a *Adjustments) Validate() map[string]string {
+	errs := map[string]string{}
+	between := func(name string, v, lo, hi float64) {
+		if v < lo || v > hi {
+			errs[name] = fmt.Sprintf("must be between %g and %g", lo, hi)
+		}
+	}
+	between("rotation", a.Rotation, -360, 360)
+	between("brightness", a.Brightness, -1, 1)
+	between("contrast", a.Contrast, -1, 1)
+	if a.Gamma != 0 {
+		between("gamma", a.Gamma, 0.1, 10)
+	}
+	between("edge_emphasis", a.EdgeEmphasis, 0, 1)
+
+	if c := a.Crop; c != nil {
+		if c.Shape != "rect" && c.Shape != "circle" {
+			errs["crop.shape"] = "must be rect or circle"
+		}
+		between("crop.x", c.X, 0, 1)
+		between("crop.y", c.Y, 0, 1)
+		if c.Width <= 0 || c.X+c.Width > 1+1e-9 {
+			errs["crop.width"] = "must be greater than 0 and keep the crop inside the image"
+		}
+		if c.Height <= 0 || c.Y+c.Height > 1+1e-9 {
+			errs["crop.height"] = "must be greater than 0 and keep the crop inside the image"
+		}
+	}
+	return errs
+}
+
+// Adjust makes a grayscale working copy of img, size pixels square, with a
+// applied: rotation, crop, levels, tone, edge emphasis, then inversion.
+// circle whitens everything outside the inscribed circle, as does a
+// circle crop.
+func Adjust(img image.Image, a Adjustments, size int, circle bool) *image.Gray {
+	src := img
+	if a.Rotation != 0 {
+		src = Rotate(src, a.Rotation)
+	}
+	if c := a.Crop; c != nil {
+		src = cropTo(src, *c)
+		circle = circle || c.Shape == "circle"
+	}
+	g := Gray(Square(src, size))
+	tone(g, a.Brightness, a.Contrast, a.Gamma)
+	if a.EdgeEmphasis > 0 {
+		sharpen(g, a.EdgeEmphasis)
+	}
+	if a.Invert {
+		for i, v := range g.Pix {
+			g.Pix[i] = 255 - v
+		}
+	}
+	if circle {
+		MaskCircle(g)
+	}
+	return g
+}
+
+// Rotate turns img clockwise by degrees onto a canvas just large enough to
+// hold it, filling the uncovered corners with white.
+func Rotate(img image.Image, degrees float64) *image.RGBA {
+	b := img.Bounds()
+	sin, cos := math.Sincos(degrees * math.Pi / 180)
+	w, h := float64(b.Dx()), float64(b.Dy())
+	// Trim rounding error so quarter turns don't gain a pixel
+	nw := max(1, int(math.Ceil(math.Abs(w*cos)+math.Abs(h*sin)-1e-6)))
+	nh := max(1, int(math.Ceil(math.Abs(w*sin)+math.Abs(h*cos)-1e-6)))
+	dst := image.NewRGBA(image.Rect(0, 0, nw, nh))
+
+	white := color.RGBA{255, 255, 255, 255}
+	at := func(x, y int) color.RGBA {
+		if x < 0 || y < 0 || x >= b.Dx() || y >= b.Dy() {
+			return white
+		}
+		return color.RGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.RGBA)
+	}
+	for y := 0; y < nh; y++ {
+		for x := 0; x < nw; x++ {
+			// Map the destination pixel's centre back onto the source
+			dx, dy := float64(x)+0.5-float64(nw)/2, float64(y)+0.5-float64(nh)/2
+			sx := cos*dx + sin*dy + w/2 - 0.5
+			sy := -sin*dx + cos*dy + h/2 - 0.5
+			if sx < -1 || sy < -1 || sx > w || sy > h {
+				dst.SetRGBA(x, y, white)
+				continue
+			}
+			x0, y0 := int(math.Floor(sx)), int(math.Floor(sy))
+			fx, fy := sx-float64(x0), sy-float64(y0)
+			c00, c10 := at(x0, y0), at(x0+1, y0)
+			c01, c11 := at(x0, y0+1), at(x0+1, y0+1)
+			lerp := func(v00, v10, v01, v11 uint8) uint8 {
+				top := float64(v00)*(1-fx) + float64(v10)*fx
+				bottom := float64(v01)*(1-fx) + float64(v11)*fx
+				return uint8(math.Round(top*(1-fy) + bottom*fy))
+			}
+			dst.SetRGBA(x, y, color.RGBA{
+				R: lerp(c00.R, c10.R, c01.R, c11.R), G: lerp(c00.G, c10.G, c01.G, c11.G),
+				B: lerp(c00.B, c10.B, c01.B, c11.B), A: lerp(c00.A, c10.A, c01.A, c11.A),
+			})
+		}
+	}
+	return dst
+}
+
+// cropTo returns the part of img c covers, at least one pixel square.
+func cropTo(img image.Image, c Crop) image.Image {
+	b := img.Bounds()
+	w, h := float64(b.Dx()), float64(b.Dy())
+	x0 := b.Min.X + int(math.Round(c.X*w))
+	y0 := b.Min.Y + int(math.Round(c.Y*h))
+	x1 := max(x0+1, b.Min.X+int(math.Round((c.X+c.Width)*w)))
+	y1 := max(y0+1, b.Min.Y+int(math.Round((c.Y+c.Height)*h)))
+	r := image.Rect(x0, y0, x1, y1).Intersect(b)
+	if r.Empty() {
+		return img
+	}
+	return scale(img, r, r.Dx(), r.Dy())
+}
+
+// tone applies brightness, then contrast about the midpoint, then gamma.
+func tone(g *image.Gray, brightness, contrast, gamma float64) {
+	if brightness == 0 && contrast == 0 && (gamma == 0 || gamma == 1) {
+		return
+	}
+	if gamma == 0 {
+		gamma = 1
+	}
+	// Contrast of ±1 scales the distance from mid-gray by 4 or 1/4
+	factor := math.Pow(4, contrast)
+	var lut [256]uint8
+	for i := range lut {
+		v := float64(i)/255 + brightness
+		v = (v-0.5)*factor + 0.5
+		v = math.Pow(min(1, max(0, v)), 1/gamma)
+		lut[i] = uint8(math.Round(v * 255))
+	}
+	for i, v := range g.Pix {
+		g.Pix[i] = lut[v]
+	}
+}
+
+// sharpenRadius is the blur radius of the unsharp mask, in pixels of the
+// working copy.
+const sharpenRadius = 2
+
+// sharpen emphasises edges with an unsharp mask: each pixel moves away
+// from the average of its neighbourhood by up to three times the
+// difference at full amount.
+func sharpen(g *image.Gray, amount float64) {
+	blur := boxBlur(g, sharpenRadius)
+	k := 3 * amount
+	for i, v := range g.Pix {
+		d := float64(v) - float64(blur[i])
+		g.Pix[i] = uint8(min(255, max(0, math.Round(float64(v)+k*d))))
+	}
+}
+
+// boxBlur returns g's pixels averaged over a (2r+1)² square, clamping at
+// the edges, as a horizontal pass followed by a vertical one.
+func boxBlur(g *image.Gray, r int) []uint8 {
+	w, h := g.Rect.Dx(), g.Rect.Dy()
+	tmp := make([]int, w*h)
+	for y := 0; y < h; y++ {
+		row := g.Pix[y*g.Stride : y*g.Stride+w]
+		for x := 0; x < w; x++ {
+			sum, n := 0, 0
+			for i := max(0, x-r); i <= min(w-1, x+r); i++ {
+				sum += int(row[i])
+				n++
+			}
+			tmp[y*w+x] = sum / n
+		}
+	}
+	out := make([]uint8, len(g.Pix))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sum, n := 0, 0
+			for j := max(0, y-r); j <= min(h-1, y+r); j++ {
+				sum += tmp[j*w+x]
+				n++
+			}
+			out[y*g.Stride+x] = uint8(sum / n)
+		}
+	}
+	return out
+}
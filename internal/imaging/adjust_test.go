@@ -0,0 +1,83 @@
+// internal/imaging/adjust_test.go
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestRotateQuarterTurn(t *testing.T) {
+	// 3×2, each pixel a distinct shade
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 3; x++ {
+			v := uint8(10 + 40*(y*3+x))
+			src.SetRGBA(x, y, color.RGBA{v, v, v, 255})
+		}
+	}
+
+	got := Rotate(src, 90)
+	if b := got.Bounds(); b.Dx() != 2 || b.Dy() != 3 {
+		t.Fatalf("bounds = %v, want 2×3", b)
+	}
+	// Clockwise: the bottom-left source pixel ends up top-left
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 2; x++ {
+			want := src.RGBAAt(y, 1-x)
+			if c := got.RGBAAt(x, y); c != want {
+				t.Errorf("(%d,%d) = %v, want %v", x, y, c, want)
+			}
+		}
+	}
+}
+
+func TestAdjustZeroIsWorkingCopy(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i * 7)
+	}
+	want := Gray(Square(src, 16))
+	if got := Adjust(src, Adjustments{}, 16, false); !bytes.Equal(got.Pix, want.Pix) {
+		t.Error("zero adjustments changed the working copy")
+	}
+}
+
+func TestAdjustInvertAndCircle(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 20, 20))
+	for i := range src.Pix {
+		src.Pix[i] = 255
+	}
+	got := Adjust(src, Adjustments{Invert: true, Crop: &Crop{Shape: "circle", Width: 1, Height: 1}}, 20, false)
+	if v := got.GrayAt(10, 10).Y; v != 0 {
+		t.Errorf("centre = %d, want inverted white (0)", v)
+	}
+	if v := got.GrayAt(0, 0).Y; v != 255 {
+		t.Errorf("corner = %d, want white outside the circle", v)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	ok := Adjustments{
+		Crop:     &Crop{Shape: "rect", X: 0.25, Y: 0, Width: 0.75, Height: 1},
+		Rotation: -90, Brightness: 0.2, Contrast: -1, Gamma: 2.2, EdgeEmphasis: 1,
+	}
+	if errs := ok.Validate(); len(errs) > 0 {
+		t.Errorf("valid adjustments rejected: %v", errs)
+	}
+
+	bad := Adjustments{
+		Crop:       &Crop{Shape: "oval", X: 0.5, Width: 0.6, Height: 0},
+		Brightness: 1.5, Gamma: 0.05, EdgeEmphasis: -0.1,
+	}
+	errs := bad.Validate()
+	for _, field := range []string{"crop.shape", "crop.width", "crop.height", "brightness", "gamma", "edge_emphasis"} {
+		if _, ok := errs[field]; !ok {
+			t.Errorf("%s not rejected", field)
+		}
+	}
+	if len(errs) != 6 {
+		t.Errorf("errors = %v, want 6", errs)
+	}
+}
@@ -0,0 +1,59 @@
+// internal/imaging/gray.go
+package imaging
+
+import (
+	"image"
+	"image/draw"
+)
+
+// clipFraction of pixels at each end of the histogram are allowed to clip
+// when Gray stretches levels, so a few specks don't limit the contrast.
+const clipFraction = 0.005
+
+// Gray converts img to grayscale and stretches its levels to the full
+// 0-255 range, so working copies of dim and bright photos look alike.
+func Gray(img image.Image) *image.Gray {
+	b := img.Bounds()
+	g := image.NewGray(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(g, g.Bounds(), img, b.Min, draw.Src)
+
+	var hist [256]int
+	for _, v := range g.Pix {
+		hist[v]++
+	}
+	clip := int(float64(len(g.Pix)) * clipFraction)
+	lo, hi := 0, 255
+	for n := 0; lo < 255 && n+hist[lo] <= clip; lo++ {
+		n += hist[lo]
+	}
+	for n := 0; hi > 0 && n+hist[hi] <= clip; hi-- {
+		n += hist[hi]
+	}
+	if hi <= lo {
+		return g
+	}
+	var lut [256]uint8
+	for i := range lut {
+		lut[i] = uint8(min(255, max(0, (i-lo)*255/(hi-lo))))
+	}
+	for i, v := range g.Pix {
+		g.Pix[i] = lut[v]
+	}
+	return g
+}
+
+// MaskCircle whitens every pixel outside the circle inscribed in g, the
+// area a circular board can't reach.
+func MaskCircle(g *image.Gray) {
+	b := g.Bounds()
+	r := float64(min(b.Dx(), b.Dy())) / 2
+	cx, cy := float64(b.Min.X)+float64(b.Dx())/2, float64(b.Min.Y)+float64(b.Dy())/2
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			dx, dy := float64(x)+0.5-cx, float64(y)+0.5-cy
+			if dx*dx+dy*dy > r*r {
+				g.Pix[g.PixOffset(x, y)] = 255
+			}
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// internal/imaging/resize.go
+package imaging
+
+import (
+	"image"
+	"image/color"
+)
+
+// Square crops img to a centred square and scales it to size×size.
+func Square(img image.Image, size int) *image.RGBA {
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy())
+	x0 := b.Min.X + (b.Dx()-side)/2
+	y0 := b.Min.Y + (b.Dy()-side)/2
+	return scale(img, image.Rect(x0, y0, x0+side, y0+side), size, size)
+}
+
+// Fit scales img down, keeping its aspect ratio, so neither side exceeds
+// maxSide. Images already small enough are copied unscaled.
+func Fit(img image.Image, maxSide int) *image.RGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > maxSide || h > maxSide {
+		if w >= h {
+			w, h = maxSide, max(1, h*maxSide/b.Dx())
+		} else {
+			w, h = max(1, w*maxSide/b.Dy()), maxSide
+		}
+	}
+	return scale(img, b, w, h)
+}
+
+// scale resamples the src rectangle of img to w×h. Each output pixel
+// averages the source pixels it covers, which is slow next to a proper
+// filter but gives clean downscales without any dependencies.
+func scale(img image.Image, src image.Rectangle, w, h int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	sw, sh := src.Dx(), src.Dy()
+	for y := 0; y < h; y++ {
+		sy0 := src.Min.Y + y*sh/h
+		sy1 := max(sy0+1, src.Min.Y+(y+1)*sh/h)
+		for x := 0; x < w; x++ {
+			sx0 := src.Min.X + x*sw/w
+			sx1 := max(sx0+1, src.Min.X+(x+1)*sw/w)
+
+			var r, g, b, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n >> 8), G: uint8(g / n >> 8),
+				B: uint8(b / n >> 8), A: uint8(a / n >> 8),
+			})
+		}
+	}
+	return dst
+}
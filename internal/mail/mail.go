@@ -0,0 +1,80 @@
+// internal/mail/mail.go
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"strings"
+
+	"stringmeup/backend/internal/config"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+}
+
+// Mailer delivers transactional email.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns an SMTP mailer when SMTP_HOST is set, otherwise a mailer that
+// only logs, which is what local development wants.
+func New(cfg *config.Config) Mailer {
+	if cfg.SMTPHost == "" {
+		return LogMailer{}
+	}
+	return &SMTPMailer{
+		addr:     net.JoinHostPort(cfg.SMTPHost, cfg.SMTPPort),
+		host:     cfg.SMTPHost,
+		username: cfg.SMTPUsername,
+		password: cfg.SMTPPassword,
+		from:     cfg.MailFrom,
+	}
+}
+
+type SMTPMailer struct {
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "From: %s\r\n", m.from)
+	fmt.Fprintf(&sb, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&sb, "Subject: %s\r\n", msg.Subject)
+	sb.WriteString("MIME-Version: 1.0\r\n")
+	sb.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	sb.WriteString(strings.ReplaceAll(msg.Text, "\n", "\r\n"))
+
+	// The envelope sender must be a bare address, without a display name.
+	envelopeFrom := m.from
+	if addr, err := netmail.ParseAddress(m.from); err == nil {
+		envelopeFrom = addr.Address
+	}
+	if err := smtp.SendMail(m.addr, auth, envelopeFrom, []string{msg.To}, []byte(sb.String())); err != nil {
+		return fmt.Errorf("smtp send: %w", err)
+	}
+	return nil
+}
+
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, msg Message) error {
+	log.Printf("mail to=%s subject=%q\n%s", msg.To, msg.Subject, msg.Text)
+	return nil
+}
@@ -5,16 +5,43 @@ import (
 	"context"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"stringmeup/backend/internal/db"
+	"stringmeup/backend/internal/signing"
 )
 
 type contextKey string
 
-const UserIDKey contextKey = "userID"
+const (
+	UserIDKey    contextKey = "userID"
+	SessionIDKey contextKey = "sessionID"
+	LocaleKey    contextKey = "locale"
+)
+
+// PATVerifier resolves a personal access token to its owner and scopes.
+type PATVerifier func(ctx context.Context, token string) (userID string, scopes []string, err error)
+
+// Account is the per-request state Authenticate checks about the user.
+type Account struct {
+	Role              string
+	Disabled          bool
+	SessionsRevokedAt *time.Time // JWTs issued at or before this are rejected
+	SessionKept       string     // except those of this session
+	// Locale is the user's chosen locale, or "" to follow the client's.
+	// It rides along with the lookup so localizing doesn't cost another
+	// query per request.
+	Locale string
+}
 
-func Authenticate(jwtSecret string) func(http.Handler) http.Handler {
+type AccountLookup func(ctx context.Context, userID string) (*Account, error)
+
+// Authenticate accepts either a session JWT or, when it carries PATPrefix,
+// a personal access token. PAT requests additionally carry their scopes for
+// RequireScopes. Every request loads the user's account so that disabling
+// it or forcing a logout takes effect immediately, not when the JWT expires.
+func Authenticate(keys *signing.Keyring, verifyPAT PATVerifier, lookup AccountLookup) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			header := r.Header.Get("Authorization")
@@ -23,20 +50,48 @@ func Authenticate(jwtSecret string) func(http.Handler) http.Handler {
 				return
 			}
 
+			ctx := r.Context()
+			var userID, sessionID string
+			var issuedAt time.Time
 			tokenStr := strings.TrimPrefix(header, "Bearer ")
-			claims := &jwt.RegisteredClaims{}
-			token, err := jwt.ParseWithClaims(tokenStr, claims,
-				func(t *jwt.Token) (any, error) {
-					return []byte(jwtSecret), nil
-				},
-				jwt.WithValidMethods([]string{"HS256"}),
-			)
-			if err != nil || !token.Valid {
+			if strings.HasPrefix(tokenStr, PATPrefix) {
+				id, scopes, err := verifyPAT(ctx, tokenStr)
+				if err != nil {
+					db.Error(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid token")
+					return
+				}
+				userID = id
+				ctx = context.WithValue(ctx, ScopesKey, scopes)
+			} else {
+				claims := &jwt.RegisteredClaims{}
+				token, err := keys.Parse(tokenStr, claims)
+				if err != nil || !token.Valid || claims.IssuedAt == nil {
+					db.Error(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid token")
+					return
+				}
+				userID, sessionID, issuedAt = claims.Subject, claims.ID, claims.IssuedAt.Time
+			}
+
+			acct, err := lookup(ctx, userID)
+			if err != nil {
 				db.Error(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid token")
 				return
 			}
+			if acct.Disabled {
+				db.Error(w, http.StatusForbidden, "ACCOUNT_DISABLED", "account is disabled")
+				return
+			}
+			if !issuedAt.IsZero() && acct.SessionsRevokedAt != nil &&
+				!issuedAt.After(*acct.SessionsRevokedAt) &&
+				(sessionID == "" || sessionID != acct.SessionKept) {
+				db.Error(w, http.StatusUnauthorized, "UNAUTHORIZED", "session revoked")
+				return
+			}
 
-			ctx := context.WithValue(r.Context(), UserIDKey, claims.Subject)
+			ctx = context.WithValue(ctx, UserIDKey, userID)
+			ctx = context.WithValue(ctx, SessionIDKey, sessionID)
+			ctx = context.WithValue(ctx, RoleKey, acct.Role)
+			ctx = context.WithValue(ctx, LocaleKey, acct.Locale)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
@@ -46,3 +101,16 @@ func UserID(r *http.Request) string {
 	id, _ := r.Context().Value(UserIDKey).(string)
 	return id
 }
+
+// SessionID returns the session a JWT-authenticated request belongs to, or
+// "" for personal access tokens and tokens issued before sessions had IDs.
+func SessionID(r *http.Request) string {
+	id, _ := r.Context().Value(SessionIDKey).(string)
+	return id
+}
+
+// Locale returns the locale the authenticated user chose, or "".
+func Locale(r *http.Request) string {
+	loc, _ := r.Context().Value(LocaleKey).(string)
+	return loc
+}
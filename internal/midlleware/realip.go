@@ -0,0 +1,67 @@
+// internal/middleware/realip.go
+package midlleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// RealIP replaces RemoteAddr with the client address from X-Forwarded-For
+// or X-Real-IP, but only when the request came straight from one of the
+// trusted proxies. Anyone else could put any address in those headers, and
+// login throttling keys on the result, so their requests keep the socket
+// peer's address.
+func RealIP(trusted []*net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ip := forwardedFor(r, trusted); ip != "" {
+				r.RemoteAddr = ip
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// forwardedFor returns the client address the trusted proxies in front of
+// r report, or "" if r didn't come from one. X-Forwarded-For is read from
+// the right, skipping trusted hops, since entries to the left of the last
+// untrusted one were written by the client.
+func forwardedFor(r *http.Request, trusted []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !isTrusted(net.ParseIP(host), trusted) {
+		return ""
+	}
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		hops := strings.Split(xff, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				return ""
+			}
+			if !isTrusted(ip, trusted) {
+				return ip.String()
+			}
+		}
+		return ""
+	}
+	if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+func isTrusted(ip net.IP, trusted []*net.IPNet) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+// internal/middleware/roles.go
+package midlleware
+
+import (
+	"net/http"
+
+	"stringmeup/backend/internal/db"
+)
+
+const RoleKey contextKey = "role"
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+func Role(r *http.Request) string {
+	role, _ := r.Context().Value(RoleKey).(string)
+	return role
+}
+
+// RequireRole rejects users whose role is not role. It relies on the role
+// Authenticate loaded for this request.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if Role(r) != role {
+				db.Error(w, http.StatusForbidden, "FORBIDDEN", "insufficient permissions")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
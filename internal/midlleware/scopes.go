@@ -0,0 +1,75 @@
+// internal/middleware/scopes.go
+package midlleware
+
+import (
+	"net/http"
+	"slices"
+
+	"stringmeup/backend/internal/db"
+)
+
+// PATPrefix marks a bearer token as a personal access token rather than a JWT.
+const PATPrefix = "tcp_"
+
+const ScopesKey contextKey = "scopes"
+
+// Scopes that can be granted to a personal access token.
+const (
+	ScopeProfileRead   = "profile:read"
+	ScopeProfileWrite  = "profile:write"
+	ScopeProjectsRead  = "projects:read"
+	ScopeProjectsWrite = "projects:write"
+	ScopeProgressRead  = "progress:read"
+	ScopeProgressWrite = "progress:write"
+	ScopeUploadsWrite  = "uploads:write"
+)
+
+var KnownScopes = []string{
+	ScopeProfileRead, ScopeProfileWrite,
+	ScopeProjectsRead, ScopeProjectsWrite,
+	ScopeProgressRead, ScopeProgressWrite,
+	ScopeUploadsWrite,
+}
+
+// Scopes returns the scopes granted to the request's personal access token,
+// or nil when the request carries a normal session JWT.
+func Scopes(r *http.Request) []string {
+	scopes, _ := r.Context().Value(ScopesKey).([]string)
+	return scopes
+}
+
+func isPAT(r *http.Request) bool {
+	_, ok := r.Context().Value(ScopesKey).([]string)
+	return ok
+}
+
+// RequireScopes rejects personal access tokens that lack any of scopes.
+// Session JWTs have full access and always pass.
+func RequireScopes(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isPAT(r) {
+				granted := Scopes(r)
+				for _, s := range scopes {
+					if !slices.Contains(granted, s) {
+						db.Error(w, http.StatusForbidden, "FORBIDDEN", "token is missing scope "+s)
+						return
+					}
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireSession rejects personal access tokens outright, for account
+// management routes a script should never reach.
+func RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isPAT(r) {
+			db.Error(w, http.StatusForbidden, "FORBIDDEN", "not available to access tokens")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,73 @@
+// internal/notifications/handler.go
+package notifications
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"stringmeup/backend/internal/db"
+	"stringmeup/backend/internal/middleware"
+)
+
+func RegisterRoutes(r chi.Router, svc *Service) {
+	read := middleware.RequireScopes(middleware.ScopeProfileRead)
+	write := middleware.RequireScopes(middleware.ScopeProfileWrite)
+
+	r.With(read).Get("/notifications", handleList(svc))
+	r.With(read).Get("/notifications/unread-count", handleUnreadCount(svc))
+	r.With(write).Post("/notifications/read-all", handleMarkAllRead(svc))
+	r.With(write).Post("/notifications/{id}/read", handleMarkRead(svc))
+}
+
+func handleList(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		limit, _ := strconv.Atoi(q.Get("limit"))
+		if limit < 1 || limit > 100 {
+			limit = 20
+		}
+		list, page, err := svc.List(r.Context(), middleware.UserID(r), q.Get("cursor"), limit, q.Get("unread") == "true")
+		if errors.Is(err, ErrInvalidCursor) {
+			db.Error(w, http.StatusBadRequest, "VALIDATION_ERROR", err.Error())
+			return
+		}
+		if err != nil {
+			db.Error(w, http.StatusInternalServerError, "SERVER_ERROR", err.Error())
+			return
+		}
+		db.JSON(w, http.StatusOK, map[string]any{"data": list, "meta": page})
+	}
+}
+
+func handleUnreadCount(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		n, err := svc.UnreadCount(r.Context(), middleware.UserID(r))
+		if err != nil {
+			db.Error(w, http.StatusInternalServerError, "SERVER_ERROR", err.Error())
+			return
+		}
+		db.Data(w, http.StatusOK, map[string]int{"unread_count": n})
+	}
+}
+
+func handleMarkRead(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := svc.MarkRead(r.Context(), middleware.UserID(r), chi.URLParam(r, "id")); err != nil {
+			db.Error(w, http.StatusNotFound, "NOT_FOUND", "notification not found")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func handleMarkAllRead(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := svc.MarkAllRead(r.Context(), middleware.UserID(r)); err != nil {
+			db.Error(w, http.StatusInternalServerError, "SERVER_ERROR", err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,231 @@
+// internal/notifications/service.go
+package notifications
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"stringmeup/backend/internal/i18n"
+)
+
+// Kind groups notifications so users can turn each group off.
+type Kind string
+
+const (
+	KindExportReady Kind = "export_ready"
+	KindSecurity    Kind = "security"
+)
+
+// prefKeys maps each kind to the user preference that enables it. The
+// preferences all default to true in the users package; a user who has
+// never set one is notified.
+var prefKeys = map[Kind]string{
+	KindExportReady: "notify_export_ready",
+	KindSecurity:    "notify_security",
+}
+
+// Read notifications are kept this long
+const retention = 90 * 24 * time.Hour
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type Notification struct {
+	ID        string         `json:"id"`
+	Kind      Kind           `json:"kind"`
+	Title     string         `json:"title"`
+	Body      string         `json:"body"`
+	Data      map[string]any `json:"data"`
+	ReadAt    *time.Time     `json:"read_at"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+type Page struct {
+	NextCursor  string `json:"next_cursor,omitempty"`
+	UnreadCount int    `json:"unread_count"`
+}
+
+type Service struct {
+	db *pgxpool.Pool
+}
+
+func NewService(db *pgxpool.Pool) *Service {
+	return &Service{db: db}
+}
+
+// Notify adds a notification to the user's inbox unless they have turned
+// its kind off. Its title and body are the i18n messages key+".title" and
+// key+".body" formatted with args, translated when the user reads them;
+// time.Time args are shown as dates. Failures are logged rather than
+// returned: a missed notification shouldn't fail the action that caused it.
+func (s *Service) Notify(ctx context.Context, userID string, kind Kind, key string, args []any, data map[string]any) {
+	if data == nil {
+		data = map[string]any{}
+	}
+	stored := make([]any, len(args))
+	for i, a := range args {
+		if t, ok := a.(time.Time); ok {
+			a = map[string]any{"date": t.Format(time.RFC3339Nano)}
+		}
+		stored[i] = a
+	}
+	title, body := message(i18n.Default, key, stored)
+	_, err := s.db.Exec(ctx,
+		`INSERT INTO notifications (user_id, kind, title, body, data, message_key, args)
+		 SELECT id, $2, $3, $4, $5, $6, $7 FROM users
+		 WHERE id = $1 AND COALESCE((preferences->>$8)::boolean, TRUE)`,
+		userID, kind, title, body, data, key, stored, prefKeys[kind])
+	if err != nil {
+		log.Printf("notifications: notify %s: %v", userID, err)
+	}
+}
+
+// message formats the title and body for key in locale with args as
+// Notify stores them.
+func message(locale, key string, args []any) (title, body string) {
+	vals := make([]any, len(args))
+	for i, a := range args {
+		vals[i] = a
+		if v, ok := a.(map[string]any); ok {
+			if t, err := time.Parse(time.RFC3339Nano, fmt.Sprint(v["date"])); err == nil {
+				vals[i] = i18n.Date(locale, t)
+			}
+		}
+	}
+	return i18n.T(locale, key+".title", vals...), i18n.T(locale, key+".body", vals...)
+}
+
+// List returns the user's notifications newest first, in the locale of
+// the request in ctx. cursor is the NextCursor of the previous page, or
+// empty for the first.
+func (s *Service) List(ctx context.Context, userID, cursor string, limit int, unreadOnly bool) ([]Notification, Page, error) {
+	before, beforeID, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, Page{}, err
+	}
+
+	rows, err := s.db.Query(ctx,
+		`SELECT id, kind, title, body, data, read_at, created_at, message_key, args
+		 FROM notifications
+		 WHERE user_id = $1
+		   AND ($2::timestamptz IS NULL OR (created_at, id) < ($2, $3::uuid))
+		   AND (NOT $4 OR read_at IS NULL)
+		 ORDER BY created_at DESC, id DESC
+		 LIMIT $5`,
+		userID, before, beforeID, unreadOnly, limit+1)
+	if err != nil {
+		return nil, Page{}, err
+	}
+	defer rows.Close()
+
+	loc := i18n.FromContext(ctx)
+	list := []Notification{}
+	for rows.Next() {
+		var n Notification
+		var key *string
+		var args []any
+		if err := rows.Scan(&n.ID, &n.Kind, &n.Title, &n.Body, &n.Data, &n.ReadAt, &n.CreatedAt,
+			&key, &args); err != nil {
+			return nil, Page{}, err
+		}
+		if key != nil {
+			n.Title, n.Body = message(loc, *key, args)
+		}
+		list = append(list, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, Page{}, err
+	}
+
+	var page Page
+	if len(list) > limit {
+		list = list[:limit]
+		last := list[limit-1]
+		page.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+	if page.UnreadCount, err = s.UnreadCount(ctx, userID); err != nil {
+		return nil, Page{}, err
+	}
+	return list, page, nil
+}
+
+func (s *Service) UnreadCount(ctx context.Context, userID string) (int, error) {
+	var n int
+	err := s.db.QueryRow(ctx,
+		`SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`, userID,
+	).Scan(&n)
+	return n, err
+}
+
+func (s *Service) MarkRead(ctx context.Context, userID, id string) error {
+	tag, err := s.db.Exec(ctx,
+		`UPDATE notifications SET read_at = COALESCE(read_at, NOW())
+		 WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("notification not found")
+	}
+	return nil
+}
+
+func (s *Service) MarkAllRead(ctx context.Context, userID string) error {
+	_, err := s.db.Exec(ctx,
+		`UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL`, userID)
+	return err
+}
+
+// Run prunes old read notifications until ctx is cancelled.
+func (s *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		_, err := s.db.Exec(ctx,
+			`DELETE FROM notifications WHERE read_at IS NOT NULL AND created_at < $1`,
+			time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("notifications: prune: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// A cursor is the created_at and ID of the last notification on a page,
+// so new notifications arriving between requests don't shift later pages.
+func encodeCursor(t time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString(
+		[]byte(t.UTC().Format(time.RFC3339Nano) + "|" + id))
+}
+
+func decodeCursor(cursor string) (*time.Time, *string, error) {
+	if cursor == "" {
+		return nil, nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, nil, ErrInvalidCursor
+	}
+	ts, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, nil, ErrInvalidCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return nil, nil, ErrInvalidCursor
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, nil, ErrInvalidCursor
+	}
+	return &t, &id, nil
+}
@@ -0,0 +1,30 @@
+// internal/profiles/handler.go
+package profiles
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"stringmeup/backend/internal/db"
+)
+
+// RegisterRoutes mounts the public profile routes, which need no login.
+func RegisterRoutes(r chi.Router, svc *Service) {
+	r.Get("/profiles/{handle}", handleGet(svc))
+}
+
+func handleGet(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, err := svc.Get(r.Context(), chi.URLParam(r, "handle"))
+		if errors.Is(err, ErrNotFound) {
+			db.Error(w, http.StatusNotFound, "NOT_FOUND", err.Error())
+			return
+		}
+		if err != nil {
+			db.Error(w, http.StatusInternalServerError, "SERVER_ERROR", err.Error())
+			return
+		}
+		db.Data(w, http.StatusOK, p)
+	}
+}
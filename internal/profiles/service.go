@@ -0,0 +1,141 @@
+// internal/profiles/service.go
+package profiles
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"stringmeup/backend/internal/uploads"
+	"stringmeup/backend/internal/users"
+)
+
+// Published projects shown on a profile, newest first
+const maxProjects = 50
+
+var ErrNotFound = errors.New("profile not found")
+
+type Profile struct {
+	Handle    string    `json:"handle"`
+	Name      string    `json:"name"`
+	Bio       string    `json:"bio"`
+	AvatarURL string    `json:"avatar_url"`
+	JoinedAt  time.Time `json:"joined_at"`
+	// Nil when the user hides them
+	Stats    *Stats          `json:"stats,omitempty"`
+	Projects []PublicProject `json:"projects,omitempty"`
+}
+
+type Stats struct {
+	Projects          int `json:"projects"`
+	CompletedProjects int `json:"completed_projects"`
+	StepsCompleted    int `json:"steps_completed"`
+}
+
+// PublicProject is the subset of a project safe to show anyone. The string
+// plan stays private, and so does the original image, which may still
+// carry EXIF location data; only its re-encoded derivatives are shown.
+type PublicProject struct {
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	Shape       string    `json:"shape"`
+	SizeInches  float64   `json:"size_inches"`
+	NailCount   int       `json:"nail_count"`
+	LayerCount  int       `json:"layer_count"`
+	PublishedAt time.Time `json:"published_at"`
+	// Set once the image has been processed
+	Thumbnails      map[string]string `json:"thumbnails,omitempty"`
+	WorkingImageURL string            `json:"working_image_url,omitempty"`
+}
+
+type Service struct {
+	db      *pgxpool.Pool
+	users   *users.Service
+	uploads *uploads.Service
+}
+
+func NewService(db *pgxpool.Pool, users *users.Service, uploads *uploads.Service) *Service {
+	return &Service{db: db, users: users, uploads: uploads}
+}
+
+// Get returns the public profile for handle. Private profiles, and those of
+// disabled or deleted accounts, are reported as not found.
+func (s *Service) Get(ctx context.Context, handle string) (*Profile, error) {
+	p := &Profile{}
+	var userID, avatarKey string
+	err := s.db.QueryRow(ctx,
+		`SELECT id, handle, name, bio, avatar_key, created_at FROM users
+		 WHERE handle = $1 AND disabled_at IS NULL AND deletion_scheduled_at IS NULL`,
+		strings.ToLower(handle),
+	).Scan(&userID, &p.Handle, &p.Name, &p.Bio, &avatarKey, &p.JoinedAt)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	prefs, err := s.users.Preferences(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !prefs.Bool("profile_public") {
+		return nil, ErrNotFound
+	}
+	if avatarKey != "" {
+		p.AvatarURL = s.uploads.URL(avatarKey)
+	}
+
+	if prefs.Bool("profile_show_stats") {
+		st := &Stats{}
+		err := s.db.QueryRow(ctx,
+			`SELECT COUNT(*),
+			        COUNT(*) FILTER (WHERE p.status = 'completed'),
+			        COALESCE(SUM(pp.current_step), 0)
+			 FROM projects p LEFT JOIN project_progress pp ON pp.project_id = p.id
+			 WHERE p.user_id = $1`, userID,
+		).Scan(&st.Projects, &st.CompletedProjects, &st.StepsCompleted)
+		if err != nil {
+			return nil, err
+		}
+		p.Stats = st
+	}
+
+	if prefs.Bool("profile_show_projects") {
+		if p.Projects, err = s.published(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func (s *Service) published(ctx context.Context, userID string) ([]PublicProject, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT id, title, shape, size_inches, nail_count, layer_count,
+		        published_at, working_image_key,
+		        (SELECT processing FROM uploads WHERE uploads.id = image_upload_id), image_upload_id
+		 FROM projects WHERE user_id = $1 AND published_at IS NOT NULL
+		 ORDER BY published_at DESC LIMIT $2`, userID, maxProjects)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []PublicProject{}
+	for rows.Next() {
+		var pp PublicProject
+		var workingKey string
+		var processing, uploadID *string
+		if err := rows.Scan(&pp.ID, &pp.Title, &pp.Shape, &pp.SizeInches, &pp.NailCount,
+			&pp.LayerCount, &pp.PublishedAt, &workingKey, &processing, &uploadID); err != nil {
+			return nil, err
+		}
+		// Show the image as the owner adjusted it
+		if workingKey != "" {
+			pp.Thumbnails, pp.WorkingImageURL = s.uploads.AdjustedThumbnails(workingKey), s.uploads.URL(workingKey)
+		} else if uploadID != nil && processing != nil && *processing == uploads.ProcessingReady {
+			d := s.uploads.Derivatives(userID, *uploadID)
+			pp.Thumbnails, pp.WorkingImageURL = d.Thumbnails, d.WorkingFor(pp.Shape)
+		}
+		list = append(list, pp)
+	}
+	return list, rows.Err()
+}
@@ -3,26 +3,33 @@ package projects
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
+	"stringmeup/backend/internal/billing"
 	"stringmeup/backend/internal/db"
 	"stringmeup/backend/internal/middleware"
 	"stringmeup/backend/internal/progress"
 )
 
 func RegisterRoutes(r chi.Router, svc *Service, progressSvc *progress.Service) {
-	r.Get("/projects", handleList(svc))
-	r.Post("/projects", handleCreate(svc))
+	read := middleware.RequireScopes(middleware.ScopeProjectsRead)
+	write := middleware.RequireScopes(middleware.ScopeProjectsWrite)
+
+	r.With(read).Get("/projects", handleList(svc))
+	r.With(write).Post("/projects", handleCreate(svc))
 
 	r.Route("/projects/{id}", func(r chi.Router) {
-		r.Get("/", handleGet(svc))
-		r.Patch("/", handleUpdate(svc))
-		r.Delete("/", handleDelete(svc))
-		r.Get("/export", handleExport(svc))
-		r.Get("/progress", progress.HandleGet(progressSvc))
-		r.Put("/progress", progress.HandlePut(progressSvc))
+		r.With(read).Get("/", handleGet(svc))
+		r.With(write).Patch("/", handleUpdate(svc))
+		r.With(write).Delete("/", handleDelete(svc))
+		r.With(read).Get("/export", handleExport(svc))
+		r.With(middleware.RequireScopes(middleware.ScopeProgressRead)).
+			Get("/progress", progress.HandleGet(progressSvc))
+		r.With(middleware.RequireScopes(middleware.ScopeProgressWrite)).
+			Put("/progress", progress.HandlePut(progressSvc))
 	})
 }
 
@@ -54,6 +61,14 @@ func handleCreate(svc *Service) http.HandlerFunc {
 			return
 		}
 		p, err := svc.Create(r.Context(), middleware.UserID(r), body)
+		var fieldErrs FieldErrors
+		if errors.As(err, &fieldErrs) {
+			db.FieldErrors(w, fieldErrs)
+			return
+		}
+		if billing.WriteLimitError(w, err) {
+			return
+		}
 		if err != nil {
 			db.Error(w, http.StatusInternalServerError, "SERVER_ERROR", err.Error())
 			return
@@ -81,10 +96,22 @@ func handleUpdate(svc *Service) http.HandlerFunc {
 			return
 		}
 		p, err := svc.Update(r.Context(), chi.URLParam(r, "id"), middleware.UserID(r), body)
-		if err != nil {
+		var fieldErrs FieldErrors
+		if errors.As(err, &fieldErrs) {
+			db.FieldErrors(w, fieldErrs)
+			return
+		}
+		if billing.WriteLimitError(w, err) {
+			return
+		}
+		if errors.Is(err, ErrNotFound) {
 			db.Error(w, http.StatusNotFound, "NOT_FOUND", "project not found")
 			return
 		}
+		if err != nil {
+			db.Error(w, http.StatusInternalServerError, "SERVER_ERROR", err.Error())
+			return
+		}
 		db.Data(w, http.StatusOK, p)
 	}
 }
@@ -2,13 +2,24 @@
 package projects
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"stringmeup/backend/internal/billing"
+	"stringmeup/backend/internal/i18n"
+	"stringmeup/backend/internal/imaging"
+	"stringmeup/backend/internal/units"
+	"stringmeup/backend/internal/uploads"
+	"stringmeup/backend/internal/users"
 )
 
 type Project struct {
@@ -27,6 +38,225 @@ type Project struct {
 	Status         string    `json:"status"`
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"`
+	// Size and NailDiameter repeat the stored values in the user's
+	// preferred units, for display
+	Size         *units.Length `json:"size,omitempty"`
+	NailDiameter *units.Length `json:"nail_diameter,omitempty"`
+	// Set while the project is shown on the owner's public profile
+	PublishedAt *time.Time `json:"published_at"`
+	// ImageUploadID is how clients set the image; ImageRemoteURL follows it
+	ImageUploadID *string `json:"image_upload_id"`
+	// Derived from the image once processing finishes, or with
+	// ImageAdjustments applied when there are any. Clients show
+	// thumbnails instead of the original, and generation reads the
+	// grayscale working copy cropped to the board's shape.
+	Thumbnails      map[string]string `json:"thumbnails,omitempty"`
+	WorkingImageURL string            `json:"working_image_url,omitempty"`
+	// ImageAdjustments are applied to the image by the server to make the
+	// working copy, so every device generates from the same pixels. Null
+	// leaves the image as uploaded.
+	ImageAdjustments *imaging.Adjustments `json:"image_adjustments"`
+
+	// imageRef is the stored image_remote_url: an object key, or a full
+	// URL on projects from before private buckets
+	imageRef string
+	// workingKey is the working copy rendered with ImageAdjustments, if
+	// they change anything
+	workingKey string
+}
+
+var ErrNotFound = errors.New("project not found")
+
+// ImageRef returns the project's image as stored, for services that read
+// the object itself.
+func (p *Project) ImageRef() string {
+	return p.imageRef
+}
+
+// localize fills in the display lengths for sys.
+func (p *Project) localize(sys units.System) {
+	size := units.Inches(p.SizeInches).To(units.SizeUnit(sys))
+	diameter := units.Millimetres(p.NailDiameterMM).To(units.DiameterUnit(sys))
+	p.Size, p.NailDiameter = &size, &diameter
+}
+
+// resolveImage replaces the stored image reference with a URL clients can
+// fetch, and links the image's derivatives if processing has finished.
+// Adjusted images link the working copy and previews made with the
+// adjustments, which exist as soon as the project is saved.
+func (p *Project) resolveImage(up *uploads.Service, processing *string) {
+	p.imageRef = p.ImageRemoteURL
+	p.ImageRemoteURL = up.ResolveURL(p.UserID, p.imageRef)
+	if p.workingKey != "" {
+		p.WorkingImageURL = up.URL(p.workingKey)
+		p.Thumbnails = up.AdjustedThumbnails(p.workingKey)
+		return
+	}
+	if p.ImageUploadID == nil || processing == nil || *processing != uploads.ProcessingReady {
+		return
+	}
+	d := up.Derivatives(p.UserID, *p.ImageUploadID)
+	p.Thumbnails, p.WorkingImageURL = d.Thumbnails, d.WorkingFor(p.Shape)
+}
+
+// FieldErrors is returned when a create or update fails validation, keyed
+// by field name.
+type FieldErrors map[string]string
+
+func (e FieldErrors) Error() string {
+	return fmt.Sprintf("%d invalid fields", len(e))
+}
+
+// parseImage resolves image_upload_id to one of the user's completed
+// uploads. image_remote_url can no longer be set directly, since clients
+// could point it at anyone's object.
+func (s *Service) parseImage(ctx context.Context, userID string, body map[string]any, errs FieldErrors) *uploads.Upload {
+	if _, ok := body["image_remote_url"]; ok {
+		errs["image_remote_url"] = "is read-only; set image_upload_id instead"
+	}
+	id, ok := body["image_upload_id"].(string)
+	if !ok {
+		if v, set := body["image_upload_id"]; set && v != nil {
+			errs["image_upload_id"] = "must be a string or null"
+		}
+		return nil
+	}
+	u, err := s.uploads.Owned(ctx, id, userID)
+	if err != nil {
+		errs["image_upload_id"] = "must be one of your completed uploads"
+		return nil
+	}
+	return u
+}
+
+// parseAdjustments reads "image_adjustments". set reports whether the body
+// has the key at all; null, or adjustments that change nothing, clear them.
+func parseAdjustments(body map[string]any, errs FieldErrors) (adj *imaging.Adjustments, set bool) {
+	raw, set := body["image_adjustments"]
+	if raw == nil {
+		return nil, set
+	}
+	data, _ := json.Marshal(raw)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	adj = &imaging.Adjustments{}
+	if err := dec.Decode(adj); err != nil {
+		errs["image_adjustments"] = "must be an object of known adjustments"
+		return nil, true
+	}
+	for field, msg := range adj.Validate() {
+		errs["image_adjustments."+field] = msg
+	}
+	if adj.IsZero() {
+		return nil, true
+	}
+	return adj, true
+}
+
+// working is the adjusted working copy a project is about to use.
+type working struct {
+	up    *uploads.Upload
+	shape string
+	adj   *imaging.Adjustments
+	// key is "" when the upload's plain copy will do
+	key string
+}
+
+func newWorking(up *uploads.Upload, shape string, adj *imaging.Adjustments) working {
+	if up == nil || adj == nil {
+		return working{}
+	}
+	return working{up: up, shape: shape, adj: adj, key: uploads.AdjustedKey(up, shape, *adj)}
+}
+
+// attach renders w's copy if it doesn't exist yet. It holds the copy's
+// lock until tx ends, so dropWorking can't delete it before the project
+// that uses it is committed.
+func (w working) attach(ctx context.Context, s *Service, tx pgx.Tx) error {
+	if w.key == "" {
+		return nil
+	}
+	if err := lockWorking(ctx, tx, w.key); err != nil {
+		return err
+	}
+	_, err := s.uploads.Adjusted(ctx, w.up, w.shape, *w.adj)
+	if errors.Is(err, uploads.ErrUnsupported) {
+		return FieldErrors{"image_adjustments": "can't be applied to " + w.up.ContentType + " images yet"}
+	}
+	if err != nil {
+		return fmt.Errorf("render working copy: %w", err)
+	}
+	return nil
+}
+
+func lockWorking(ctx context.Context, tx pgx.Tx, key string) error {
+	_, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended($1, 0))`, "working:"+key)
+	return err
+}
+
+// dropWorking deletes an adjusted working copy once no project uses it,
+// including a copy rendered for a save that then failed.
+func (s *Service) dropWorking(ctx context.Context, key string) {
+	err := func() error {
+		tx, err := s.db.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(ctx)
+		if err := lockWorking(ctx, tx, key); err != nil {
+			return err
+		}
+		var used bool
+		if err := tx.QueryRow(ctx,
+			`SELECT EXISTS (SELECT 1 FROM projects WHERE working_image_key = $1)`, key).Scan(&used); err != nil {
+			return err
+		}
+		if used {
+			return nil
+		}
+		if err := s.uploads.DropAdjusted(ctx, key); err != nil {
+			return err
+		}
+		return tx.Commit(ctx)
+	}()
+	if err != nil {
+		log.Printf("projects: drop working copy %s: %v", key, err)
+	}
+}
+
+// parseLengths reads "size" and "nail_diameter" from body. Each may be a
+// {"value", "unit"} object or a bare number in the user's preferred units.
+// They take precedence over the legacy size_inches and nail_diameter_mm.
+func parseLengths(body map[string]any, sys units.System, errs FieldErrors) (sizeIn, diameterMM *float64) {
+	if v, ok := body["size_inches"].(float64); ok {
+		sizeIn = &v
+	}
+	if v, ok := body["nail_diameter_mm"].(float64); ok {
+		diameterMM = &v
+	}
+	if raw, ok := body["size"]; ok {
+		if l, err := units.Parse(raw, units.SizeUnit(sys)); err != nil {
+			errs["size"] = err.Error()
+		} else {
+			v := l.Inches()
+			sizeIn = &v
+		}
+	}
+	if raw, ok := body["nail_diameter"]; ok {
+		if l, err := units.Parse(raw, units.DiameterUnit(sys)); err != nil {
+			errs["nail_diameter"] = err.Error()
+		} else {
+			v := l.MM()
+			diameterMM = &v
+		}
+	}
+	if sizeIn != nil && *sizeIn <= 0 {
+		errs["size"] = "must be greater than zero"
+	}
+	if diameterMM != nil && *diameterMM <= 0 {
+		errs["nail_diameter"] = "must be greater than zero"
+	}
+	return sizeIn, diameterMM
 }
 
 type ListMeta struct {
@@ -36,10 +266,15 @@ type ListMeta struct {
 }
 
 type Service struct {
-	db *pgxpool.Pool
+	db      *pgxpool.Pool
+	users   *users.Service
+	billing *billing.Service
+	uploads *uploads.Service
 }
 
-func NewService(db *pgxpool.Pool) *Service { return &Service{db: db} }
+func NewService(db *pgxpool.Pool, users *users.Service, billing *billing.Service, uploads *uploads.Service) *Service {
+	return &Service{db: db, users: users, billing: billing, uploads: uploads}
+}
 
 func (s *Service) List(ctx context.Context, userID string, page, limit int) ([]Project, ListMeta, error) {
 	offset := (page - 1) * limit
@@ -49,7 +284,9 @@ func (s *Service) List(ctx context.Context, userID string, page, limit int) ([]P
 	rows, err := s.db.Query(ctx,
 		`SELECT id, user_id, title, shape, size_inches, nail_count, nail_style,
 		        nail_diameter_mm, layer_mode, layer_count, image_remote_url,
-		        string_plan_json, status, created_at, updated_at
+		        image_upload_id, string_plan_json, status, published_at, created_at, updated_at,
+		        image_adjustments, working_image_key,
+		        (SELECT processing FROM uploads WHERE uploads.id = image_upload_id)
 		 FROM projects WHERE user_id = $1
 		 ORDER BY updated_at DESC LIMIT $2 OFFSET $3`,
 		userID, limit, offset,
@@ -59,13 +296,17 @@ func (s *Service) List(ctx context.Context, userID string, page, limit int) ([]P
 	}
 	defer rows.Close()
 
+	sys := s.users.UnitSystem(ctx, userID)
 	var projects []Project
 	for rows.Next() {
 		var p Project
+		var processing *string
 		rows.Scan(&p.ID, &p.UserID, &p.Title, &p.Shape, &p.SizeInches,
 			&p.NailCount, &p.NailStyle, &p.NailDiameterMM, &p.LayerMode,
-			&p.LayerCount, &p.ImageRemoteURL, &p.StringPlanJSON, &p.Status,
-			&p.CreatedAt, &p.UpdatedAt)
+			&p.LayerCount, &p.ImageRemoteURL, &p.ImageUploadID, &p.StringPlanJSON, &p.Status,
+			&p.PublishedAt, &p.CreatedAt, &p.UpdatedAt, &p.ImageAdjustments, &p.workingKey, &processing)
+		p.localize(sys)
+		p.resolveImage(s.uploads, processing)
 		projects = append(projects, p)
 	}
 	if projects == nil {
@@ -87,27 +328,18 @@ func (s *Service) Create(ctx context.Context, userID string, body map[string]any
 	if v, ok := body["shape"].(string); ok {
 		p.Shape = v
 	}
-	if v, ok := body["size_inches"].(float64); ok {
-		p.SizeInches = v
-	}
 	if v, ok := body["nail_count"].(float64); ok {
 		p.NailCount = int(v)
 	}
 	if v, ok := body["nail_style"].(string); ok {
 		p.NailStyle = v
 	}
-	if v, ok := body["nail_diameter_mm"].(float64); ok {
-		p.NailDiameterMM = v
-	}
 	if v, ok := body["layer_mode"].(bool); ok {
 		p.LayerMode = v
 	}
 	if v, ok := body["layer_count"].(float64); ok {
 		p.LayerCount = int(v)
 	}
-	if v, ok := body["image_remote_url"].(string); ok {
-		p.ImageRemoteURL = v
-	}
 	if v, ok := body["string_plan_json"].(string); ok {
 		p.StringPlanJSON = v
 	}
@@ -115,47 +347,121 @@ func (s *Service) Create(ctx context.Context, userID string, body map[string]any
 		p.Status = v
 	}
 
-	_, err := s.db.Exec(ctx,
+	sys := s.users.UnitSystem(ctx, userID)
+	errs := FieldErrors{}
+	sizeIn, diameterMM := parseLengths(body, sys, errs)
+	image := s.parseImage(ctx, userID, body, errs)
+	p.ImageAdjustments, _ = parseAdjustments(body, errs)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	if image != nil {
+		p.ImageUploadID, p.ImageRemoteURL = &image.ID, image.Key()
+	}
+	if sizeIn != nil {
+		p.SizeInches = *sizeIn
+	}
+	if diameterMM != nil {
+		p.NailDiameterMM = *diameterMM
+	}
+
+	w := newWorking(image, p.Shape, p.ImageAdjustments)
+	p.workingKey = w.key
+	if err := s.insert(ctx, p, image, w); err != nil {
+		if w.key != "" {
+			s.dropWorking(ctx, w.key)
+		}
+		return nil, err
+	}
+	p.localize(sys)
+	var processing *string
+	if image != nil {
+		processing = &image.Processing
+	}
+	p.resolveImage(s.uploads, processing)
+	return p, nil
+}
+
+// insert checks a new project against the user's plan and stores it, with
+// its working copy and a reference to its image, in one transaction.
+func (s *Service) insert(ctx context.Context, p *Project, image *uploads.Upload, w working) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if err := s.checkPlan(ctx, tx, p.UserID, "", p.NailCount, p.LayerMode); err != nil {
+		return err
+	}
+	if err := w.attach(ctx, s, tx); err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx,
 		`INSERT INTO projects (id, user_id, title, shape, size_inches, nail_count,
 		  nail_style, nail_diameter_mm, layer_mode, layer_count, image_remote_url,
-		  string_plan_json, status, created_at, updated_at)
-		 VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15)`,
+		  image_upload_id, string_plan_json, status, created_at, updated_at,
+		  image_adjustments, working_image_key)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18)`,
 		p.ID, p.UserID, p.Title, p.Shape, p.SizeInches, p.NailCount,
 		p.NailStyle, p.NailDiameterMM, p.LayerMode, p.LayerCount,
-		p.ImageRemoteURL, p.StringPlanJSON, p.Status, p.CreatedAt, p.UpdatedAt,
+		p.ImageRemoteURL, p.ImageUploadID, p.StringPlanJSON, p.Status, p.CreatedAt, p.UpdatedAt,
+		p.ImageAdjustments, p.workingKey,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("insert project: %w", err)
+		return fmt.Errorf("insert project: %w", err)
 	}
-	return p, nil
+	if image != nil {
+		if err := s.uploads.Retain(ctx, tx, image.ID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
 }
 
 func (s *Service) GetByID(ctx context.Context, id, userID string) (*Project, error) {
 	p := &Project{}
+	var processing *string
 	err := s.db.QueryRow(ctx,
 		`SELECT id, user_id, title, shape, size_inches, nail_count, nail_style,
 		        nail_diameter_mm, layer_mode, layer_count, image_remote_url,
-		        string_plan_json, status, created_at, updated_at
+		        image_upload_id, string_plan_json, status, published_at, created_at, updated_at,
+		        image_adjustments, working_image_key,
+		        (SELECT processing FROM uploads WHERE uploads.id = image_upload_id)
 		 FROM projects WHERE id = $1 AND user_id = $2`, id, userID,
 	).Scan(&p.ID, &p.UserID, &p.Title, &p.Shape, &p.SizeInches,
 		&p.NailCount, &p.NailStyle, &p.NailDiameterMM, &p.LayerMode,
-		&p.LayerCount, &p.ImageRemoteURL, &p.StringPlanJSON, &p.Status,
-		&p.CreatedAt, &p.UpdatedAt)
+		&p.LayerCount, &p.ImageRemoteURL, &p.ImageUploadID, &p.StringPlanJSON, &p.Status,
+		&p.PublishedAt, &p.CreatedAt, &p.UpdatedAt, &p.ImageAdjustments, &p.workingKey, &processing)
 	if err != nil {
-		return nil, fmt.Errorf("project not found")
+		return nil, ErrNotFound
 	}
+	p.localize(s.users.UnitSystem(ctx, userID))
+	p.resolveImage(s.uploads, processing)
 	return p, nil
 }
 
 func (s *Service) Update(ctx context.Context, id, userID string, body map[string]any) (*Project, error) {
+	errs := FieldErrors{}
+	sizeIn, diameterMM := parseLengths(body, s.users.UnitSystem(ctx, userID), errs)
+	image := s.parseImage(ctx, userID, body, errs)
+	adj, adjSet := parseAdjustments(body, errs)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	cur, err := s.GetByID(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	status, ok := body["status"].(string)
+	reopen := ok && status != "completed"
+
 	sets := []string{"updated_at = NOW()"}
 	args := []any{}
 	i := 1
 
 	fields := map[string]string{
 		"title": "title", "shape": "shape", "status": "status",
-		"image_remote_url": "image_remote_url", "string_plan_json": "string_plan_json",
-		"nail_style": "nail_style",
+		"string_plan_json": "string_plan_json", "nail_style": "nail_style",
 	}
 	for key, col := range fields {
 		if v, ok := body[key].(string); ok {
@@ -164,13 +470,51 @@ func (s *Service) Update(ctx context.Context, id, userID string, body map[string
 			i++
 		}
 	}
-	numFields := map[string]string{
-		"size_inches": "size_inches", "nail_diameter_mm": "nail_diameter_mm",
+	v, clearImage := body["image_upload_id"]
+	clearImage = clearImage && v == nil
+	if image != nil {
+		sets = append(sets, fmt.Sprintf("image_upload_id = $%d, image_remote_url = $%d", i, i+1))
+		args = append(args, image.ID, image.Key())
+		i += 2
+	} else if clearImage {
+		sets = append(sets, "image_upload_id = NULL, image_remote_url = ''")
+	}
+
+	// Render the working copy again when anything it depends on changes
+	shape, shapeSet := body["shape"].(string)
+	var w working
+	workingKey := cur.workingKey
+	if image != nil || clearImage || adjSet || (shapeSet && shape != cur.Shape) {
+		if !shapeSet {
+			shape = cur.Shape
+		}
+		if !adjSet {
+			adj = cur.ImageAdjustments
+		}
+		up := image
+		if up == nil && !clearImage && cur.ImageUploadID != nil {
+			up, _ = s.uploads.Owned(ctx, *cur.ImageUploadID, userID)
+		}
+		w = newWorking(up, shape, adj)
+		workingKey = w.key
+		sets = append(sets, fmt.Sprintf("image_adjustments = $%d, working_image_key = $%d", i, i+1))
+		args = append(args, adj, workingKey)
+		i += 2
+	}
+	if v, ok := body["published"].(bool); ok {
+		if v {
+			sets = append(sets, "published_at = COALESCE(published_at, NOW())")
+		} else {
+			sets = append(sets, "published_at = NULL")
+		}
 	}
-	for key, col := range numFields {
-		if v, ok := body[key].(float64); ok {
+	numFields := map[string]*float64{
+		"size_inches": sizeIn, "nail_diameter_mm": diameterMM,
+	}
+	for col, v := range numFields {
+		if v != nil {
 			sets = append(sets, fmt.Sprintf("%s = $%d", col, i))
-			args = append(args, v)
+			args = append(args, *v)
 			i++
 		}
 	}
@@ -180,16 +524,137 @@ func (s *Service) Update(ctx context.Context, id, userID string, body map[string
 		`UPDATE projects SET %s WHERE id = $%d AND user_id = $%d`,
 		strings.Join(sets, ", "), i, i+1,
 	)
-	s.db.Exec(ctx, query, args...)
+	if err := s.update(ctx, id, userID, query, args, image, clearImage, w, reopen); err != nil {
+		if w.key != "" && w.key != cur.workingKey {
+			s.dropWorking(ctx, w.key)
+		}
+		return nil, err
+	}
+	if cur.workingKey != "" && cur.workingKey != workingKey {
+		s.dropWorking(ctx, cur.workingKey)
+	}
 	return s.GetByID(ctx, id, userID)
 }
 
-func (s *Service) Delete(ctx context.Context, id, userID string) error {
-	_, err := s.db.Exec(ctx,
-		`DELETE FROM projects WHERE id = $1 AND user_id = $2`, id, userID)
+// update runs an Update query with the working copy w it switches to, if
+// any, and, when it changes the project's image, moves the reference from
+// the old upload to the new one in the same transaction. When reopen is
+// set and the project is completed, it is checked against the plan first.
+func (s *Service) update(ctx context.Context, id, userID, query string, args []any, image *uploads.Upload, clearImage bool, w working, reopen bool) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if reopen {
+		if err := lockProjects(ctx, tx, userID); err != nil {
+			return err
+		}
+	}
+	// Lock the row so the image being replaced is the one released
+	var oldID *string
+	var status string
+	var nailCount int
+	var layerMode bool
+	err = tx.QueryRow(ctx,
+		`SELECT image_upload_id, status, nail_count, layer_mode
+		 FROM projects WHERE id = $1 AND user_id = $2 FOR UPDATE`, id, userID,
+	).Scan(&oldID, &status, &nailCount, &layerMode)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	// Reopening a completed project makes it count as active again
+	if reopen && status == "completed" {
+		if err := s.checkPlan(ctx, tx, userID, id, nailCount, layerMode); err != nil {
+			return err
+		}
+	}
+	if err := w.attach(ctx, s, tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("update project: %w", err)
+	}
+	if image != nil || clearImage {
+		if image != nil && (oldID == nil || *oldID != image.ID) {
+			if err := s.uploads.Retain(ctx, tx, image.ID); err != nil {
+				return err
+			}
+		}
+		if oldID != nil && (image == nil || *oldID != image.ID) {
+			if err := s.uploads.Release(ctx, tx, *oldID); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// checkPlan checks an active project against the user's plan, counting
+// their other active projects besides exceptID. It holds the user's
+// projects lock until tx ends, so concurrent saves can't both take the
+// last free slot.
+func (s *Service) checkPlan(ctx context.Context, tx pgx.Tx, userID, exceptID string, nailCount int, layerMode bool) error {
+	plan, err := s.billing.PlanFor(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := lockProjects(ctx, tx, userID); err != nil {
+		return err
+	}
+	var active int
+	err = tx.QueryRow(ctx,
+		`SELECT COUNT(*) FROM projects
+		 WHERE user_id = $1 AND status <> 'completed' AND id::text <> $2`, userID, exceptID,
+	).Scan(&active)
+	if err != nil {
+		return err
+	}
+	return plan.CheckProject(active, nailCount, layerMode)
+}
+
+func lockProjects(ctx context.Context, tx pgx.Tx, userID string) error {
+	_, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended($1, 0))`, "projects:"+userID)
 	return err
 }
 
+// Delete removes the project. Its image is left for the collector, which
+// keeps it while another project uses it.
+func (s *Service) Delete(ctx context.Context, id, userID string) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	var workingKey string
+	var imageUploadID *string
+	err = tx.QueryRow(ctx,
+		`DELETE FROM projects WHERE id = $1 AND user_id = $2
+		 RETURNING working_image_key, image_upload_id`, id, userID,
+	).Scan(&workingKey, &imageUploadID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if imageUploadID != nil {
+		if err := s.uploads.Release(ctx, tx, *imageUploadID); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	if workingKey != "" {
+		s.dropWorking(ctx, workingKey)
+	}
+	return nil
+}
+
 func (s *Service) Export(ctx context.Context, id, userID, format string) (string, error) {
 	p, err := s.GetByID(ctx, id, userID)
 	if err != nil {
@@ -199,21 +664,24 @@ func (s *Service) Export(ctx context.Context, id, userID, format string) (string
 	case "json":
 		return p.StringPlanJSON, nil
 	case "txt":
-		return buildTXT(p), nil
+		return buildTXT(p, s.users.UnitSystem(ctx, userID), i18n.FromContext(ctx)), nil
 	default:
 		return p.StringPlanJSON, nil
 	}
 }
 
-func buildTXT(p *Project) string {
+func buildTXT(p *Project, sys units.System, loc string) string {
+	size := units.Inches(p.SizeInches).To(units.SizeUnit(sys))
+	diameter := units.Millimetres(p.NailDiameterMM).To(units.DiameterUnit(sys))
+
 	var sb strings.Builder
-	sb.WriteString("ThreadCraft Instructions\n")
-	sb.WriteString(fmt.Sprintf("Project: %s\n", p.Title))
-	sb.WriteString(fmt.Sprintf("Shape: %s | Size: %.0f\" | Nails: %d | Layers: %d\n",
-		strings.ToUpper(p.Shape), p.SizeInches, p.NailCount, p.LayerCount))
-	sb.WriteString(fmt.Sprintf("Mounting: %s (%.1fmm diameter)\n",
-		strings.ToUpper(strings.ReplaceAll(p.NailStyle, "_", " ")), p.NailDiameterMM))
+	sb.WriteString(i18n.T(loc, "txt.title") + "\n")
+	sb.WriteString(i18n.T(loc, "txt.project", p.Title) + "\n")
+	sb.WriteString(i18n.T(loc, "txt.summary",
+		strings.ToUpper(p.Shape), size, p.NailCount, p.LayerCount) + "\n")
+	sb.WriteString(i18n.T(loc, "txt.mounting",
+		strings.ToUpper(strings.ReplaceAll(p.NailStyle, "_", " ")), diameter) + "\n")
 	sb.WriteString("================================================\n")
-	sb.WriteString("\n(Full step-by-step list requires string_plan_json parsing)\n")
+	sb.WriteString("\n" + i18n.T(loc, "txt.steps_unavailable") + "\n")
 	return sb.String()
 }
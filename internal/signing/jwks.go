@@ -0,0 +1,54 @@
+// internal/signing/jwks.go
+package signing
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// JWK is the RFC 8037 representation of an Ed25519 public key.
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS lists every key that may currently verify a token, including keys
+// published ahead of activation.
+func (k *Keyring) JWKS() JWKS {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	set := JWKS{Keys: make([]JWK, 0, len(k.keys))}
+	for _, kk := range k.keys {
+		set.Keys = append(set.Keys, JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(kk.public),
+			Kid: kk.kid,
+			Use: "sig",
+			Alg: "EdDSA",
+		})
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
+
+// HandleJWKS serves /.well-known/jwks.json. It is not wrapped in the usual
+// {"data": ...} envelope because JWKS clients expect the bare document.
+func HandleJWKS(k *Keyring) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(w).Encode(k.JWKS())
+	}
+}
@@ -0,0 +1,222 @@
+// internal/signing/keyring.go
+package signing
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"stringmeup/backend/internal/config"
+)
+
+// publishAhead is how long a new key is listed in the JWKS before it starts
+// signing, so services caching the JWKS pick it up before they see tokens.
+const publishAhead = 10 * time.Minute
+
+type key struct {
+	kid         string
+	private     ed25519.PrivateKey
+	public      ed25519.PublicKey
+	activatesAt time.Time
+	expiresAt   *time.Time
+}
+
+// Keyring holds the Ed25519 keys used to sign and verify access tokens.
+// Keys live in the signing_keys table so every instance shares them; each
+// instance reloads the table periodically in Run.
+type Keyring struct {
+	db          *pgxpool.Pool
+	rotateEvery time.Duration
+	retireAfter time.Duration
+	legacy      []byte
+
+	mu      sync.RWMutex
+	keys    map[string]*key
+	current *key
+}
+
+func NewKeyring(ctx context.Context, db *pgxpool.Pool, cfg *config.Config) (*Keyring, error) {
+	k := &Keyring{
+		db:          db,
+		rotateEvery: cfg.JWTRotateEvery,
+		retireAfter: cfg.JWTRetireAfter,
+	}
+	if cfg.JWTSecret != "" {
+		k.legacy = []byte(cfg.JWTSecret)
+	}
+	if err := k.rotate(ctx); err != nil {
+		return nil, err
+	}
+	if err := k.load(ctx); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Run rotates and reloads keys until ctx is cancelled.
+func (k *Keyring) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := k.rotate(ctx); err != nil {
+				log.Printf("signing: rotate: %v", err)
+			}
+			if err := k.load(ctx); err != nil {
+				log.Printf("signing: load: %v", err)
+			}
+		}
+	}
+}
+
+// Sign returns a compact EdDSA JWT with the current key's kid in the header.
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	k.mu.RLock()
+	cur := k.current
+	k.mu.RUnlock()
+	if cur == nil {
+		return "", fmt.Errorf("no active signing key")
+	}
+	t := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	t.Header["kid"] = cur.kid
+	return t.SignedString(cur.private)
+}
+
+// Parse verifies tokenStr against any unexpired key, plus the legacy HS256
+// secret when one is configured.
+func (k *Keyring) Parse(tokenStr string, claims jwt.Claims) (*jwt.Token, error) {
+	methods := []string{jwt.SigningMethodEdDSA.Alg()}
+	if k.legacy != nil {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	return jwt.ParseWithClaims(tokenStr, claims, k.keyfunc, jwt.WithValidMethods(methods))
+}
+
+func (k *Keyring) keyfunc(t *jwt.Token) (any, error) {
+	if t.Method == jwt.SigningMethodHS256 {
+		return k.legacy, nil
+	}
+	kid, _ := t.Header["kid"].(string)
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	return key.public, nil
+}
+
+// rotate creates a new key when the newest one is older than rotateEvery,
+// and schedules the keys it replaces to expire. The advisory lock keeps
+// instances from rotating at the same time.
+func (k *Keyring) rotate(ctx context.Context) error {
+	tx, err := k.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('signing_keys'))`); err != nil {
+		return fmt.Errorf("lock: %w", err)
+	}
+
+	now := time.Now().UTC()
+	var newest *time.Time
+	if err := tx.QueryRow(ctx,
+		`SELECT MAX(created_at) FROM signing_keys`).Scan(&newest); err != nil {
+		return fmt.Errorf("newest key: %w", err)
+	}
+
+	if newest == nil || now.Sub(*newest) >= k.rotateEvery {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return err
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(priv)
+		if err != nil {
+			return err
+		}
+		// The very first key has nothing to take over from, so it starts
+		// signing immediately.
+		activatesAt := now.Add(publishAhead)
+		if newest == nil {
+			activatesAt = now
+		}
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO signing_keys (kid, private_key, public_key, activates_at, created_at)
+			 VALUES ($1, $2, $3, $4, $5)`,
+			uuid.New().String(), der, []byte(pub), activatesAt, now); err != nil {
+			return fmt.Errorf("insert key: %w", err)
+		}
+	}
+
+	// Once a newer key is signing, older keys only need to outlive the
+	// tokens they already signed.
+	if _, err := tx.Exec(ctx,
+		`UPDATE signing_keys SET expires_at = $1
+		 WHERE expires_at IS NULL
+		   AND activates_at < (SELECT MAX(activates_at) FROM signing_keys WHERE activates_at <= $2)`,
+		now.Add(k.retireAfter), now); err != nil {
+		return fmt.Errorf("retire keys: %w", err)
+	}
+	if _, err := tx.Exec(ctx,
+		`DELETE FROM signing_keys WHERE expires_at < $1`, now); err != nil {
+		return fmt.Errorf("prune keys: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+func (k *Keyring) load(ctx context.Context) error {
+	rows, err := k.db.Query(ctx,
+		`SELECT kid, private_key, public_key, activates_at, expires_at
+		 FROM signing_keys
+		 WHERE expires_at IS NULL OR expires_at > NOW()
+		 ORDER BY activates_at`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	keys := map[string]*key{}
+	var current *key
+	for rows.Next() {
+		var kk key
+		var der, pub []byte
+		if err := rows.Scan(&kk.kid, &der, &pub, &kk.activatesAt, &kk.expiresAt); err != nil {
+			return err
+		}
+		priv, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			return fmt.Errorf("parse key %s: %w", kk.kid, err)
+		}
+		kk.private = priv.(ed25519.PrivateKey)
+		kk.public = ed25519.PublicKey(pub)
+		keys[kk.kid] = &kk
+		if !kk.activatesAt.After(now) {
+			current = &kk
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if current == nil {
+		return fmt.Errorf("no active signing key")
+	}
+
+	k.mu.Lock()
+	k.keys, k.current = keys, current
+	k.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,183 @@
+// internal/storage/blobs.go
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memory keeps objects in a map.
+type memory struct {
+	mu      sync.RWMutex
+	objects map[string]memObject
+}
+
+type memObject struct {
+	data []byte
+	info Object
+}
+
+func newMemory() *memory {
+	return &memory{objects: map[string]memObject{}}
+}
+
+func (m *memory) put(key, contentType string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = memObject{data: data, info: Object{
+		Key: key, Size: int64(len(data)), ContentType: contentType, LastModified: time.Now().UTC(),
+	}}
+	return nil
+}
+
+func (m *memory) get(key string) ([]byte, *Object, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	o, ok := m.objects[key]
+	if !ok {
+		return nil, nil, ErrNotFound
+	}
+	info := o.info
+	return o.data, &info, nil
+}
+
+func (m *memory) delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+func (m *memory) list(prefix string) ([]Object, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var objects []Object
+	for k, o := range m.objects {
+		if strings.HasPrefix(k, prefix) {
+			objects = append(objects, o.info)
+		}
+	}
+	slices.SortFunc(objects, func(a, b Object) int { return strings.Compare(a.Key, b.Key) })
+	return objects, nil
+}
+
+// disk keeps each object as a file under root/objects, with its content
+// type in a matching file under root/meta.
+type disk struct {
+	objects string
+	meta    string
+}
+
+type diskMeta struct {
+	ContentType string `json:"content_type"`
+}
+
+func newDisk(root string) (*disk, error) {
+	d := &disk{objects: filepath.Join(root, "objects"), meta: filepath.Join(root, "meta")}
+	for _, dir := range []string{d.objects, d.meta} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// write replaces path atomically, so readers never see half an object.
+func write(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (d *disk) put(key, contentType string, data []byte) error {
+	meta, err := json.Marshal(diskMeta{ContentType: contentType})
+	if err != nil {
+		return err
+	}
+	if err := write(filepath.Join(d.meta, filepath.FromSlash(key)), meta); err != nil {
+		return err
+	}
+	return write(filepath.Join(d.objects, filepath.FromSlash(key)), data)
+}
+
+func (d *disk) get(key string) ([]byte, *Object, error) {
+	path := filepath.Join(d.objects, filepath.FromSlash(key))
+	st, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && st.IsDir()) {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, d.info(key, st), nil
+}
+
+func (d *disk) info(key string, st fs.FileInfo) *Object {
+	var meta diskMeta
+	if raw, err := os.ReadFile(filepath.Join(d.meta, filepath.FromSlash(key))); err == nil {
+		json.Unmarshal(raw, &meta)
+	}
+	return &Object{Key: key, Size: st.Size(), ContentType: meta.ContentType, LastModified: st.ModTime().UTC()}
+}
+
+func (d *disk) delete(key string) error {
+	for _, root := range []string{d.objects, d.meta} {
+		err := os.Remove(filepath.Join(root, filepath.FromSlash(key)))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *disk) list(prefix string) ([]Object, error) {
+	var objects []Object
+	err := filepath.WalkDir(d.objects, func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(d.objects, path)
+		key := filepath.ToSlash(rel)
+		if e.IsDir() {
+			// Skip directories that can't contain a match
+			if key != "." && !strings.HasPrefix(key+"/", prefix) && !strings.HasPrefix(prefix, key+"/") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasPrefix(key, prefix) || strings.HasPrefix(e.Name(), ".tmp-") {
+			return nil
+		}
+		st, err := e.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, *d.info(key, st))
+		return nil
+	})
+	return objects, err
+}
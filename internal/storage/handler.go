@@ -0,0 +1,127 @@
+// internal/storage/handler.go
+package storage
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"stringmeup/backend/internal/db"
+)
+
+// RegisterRoutes serves a Local backend's URLs. Unsigned GETs are allowed
+// unless the backend is private, like an R2 bucket with public access.
+func RegisterRoutes(r chi.Router, l *Local) {
+	r.Post(l.path, handlePost(l))
+	r.Get(l.path+"/*", handleGet(l))
+	r.Put(l.path+"/*", handlePut(l))
+}
+
+func expired(exp string) bool {
+	t, err := strconv.ParseInt(exp, 10, 64)
+	return err != nil || time.Now().Unix() > t
+}
+
+func handleGet(l *Local) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := chi.URLParam(r, "*")
+		q := r.URL.Query()
+		if sig := q.Get("sig"); sig != "" || l.private {
+			if expired(q.Get("expires")) || !l.verify(sig, "GET", key, q.Get("expires")) {
+				db.Error(w, http.StatusForbidden, "FORBIDDEN", "invalid or expired signature")
+				return
+			}
+		}
+		if validKey(key) != nil {
+			db.Error(w, http.StatusNotFound, "NOT_FOUND", "object not found")
+			return
+		}
+		data, o, err := l.blobs.get(key)
+		if errors.Is(err, ErrNotFound) {
+			db.Error(w, http.StatusNotFound, "NOT_FOUND", "object not found")
+			return
+		}
+		if err != nil {
+			db.Error(w, http.StatusInternalServerError, "SERVER_ERROR", err.Error())
+			return
+		}
+		if o.ContentType != "" {
+			w.Header().Set("Content-Type", o.ContentType)
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(o.Size, 10))
+		w.Write(data)
+	}
+}
+
+func handlePut(l *Local) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := chi.URLParam(r, "*")
+		q := r.URL.Query()
+		ct, size, exp := q.Get("type"), q.Get("size"), q.Get("expires")
+		if expired(exp) || !l.verify(q.Get("sig"), "PUT", key, ct, size, exp) {
+			db.Error(w, http.StatusForbidden, "FORBIDDEN", "invalid or expired signature")
+			return
+		}
+		if r.Header.Get("Content-Type") != ct || strconv.FormatInt(r.ContentLength, 10) != size {
+			db.Error(w, http.StatusForbidden, "FORBIDDEN", "Content-Type and Content-Length must match the signature")
+			return
+		}
+		n, _ := strconv.ParseInt(size, 10, 64)
+		if err := l.Put(r.Context(), key, ct, r.Body, n); err != nil {
+			db.Error(w, http.StatusBadRequest, "VALIDATION_ERROR", err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// handlePost accepts the multipart form PresignPost describes. The fields
+// must come before the file, so the signature is checked before any of
+// the file is read.
+func handlePost(l *Local) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			db.Error(w, http.StatusBadRequest, "VALIDATION_ERROR", "expected a multipart form")
+			return
+		}
+		fields := map[string]string{}
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				db.Error(w, http.StatusBadRequest, "VALIDATION_ERROR", "missing file field")
+				return
+			}
+			if part.FormName() != "file" {
+				v, _ := io.ReadAll(io.LimitReader(part, 4096))
+				fields[part.FormName()] = string(v)
+				continue
+			}
+
+			key, ct, max, exp := fields["key"], fields["Content-Type"], fields["max"], fields["expires"]
+			if expired(exp) || !l.verify(fields["signature"], "POST", key, ct, max, exp) {
+				db.Error(w, http.StatusForbidden, "FORBIDDEN", "invalid or expired signature")
+				return
+			}
+			limit, _ := strconv.ParseInt(max, 10, 64)
+			data, err := io.ReadAll(io.LimitReader(part, limit+1))
+			if err != nil {
+				db.Error(w, http.StatusBadRequest, "VALIDATION_ERROR", "could not read file")
+				return
+			}
+			if len(data) == 0 || int64(len(data)) > limit {
+				db.Error(w, http.StatusBadRequest, "VALIDATION_ERROR", "file size is outside the allowed range")
+				return
+			}
+			if err := l.blobs.put(key, ct, data); err != nil {
+				db.Error(w, http.StatusInternalServerError, "SERVER_ERROR", err.Error())
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+}
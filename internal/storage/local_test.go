@@ -0,0 +1,137 @@
+// internal/storage/local_test.go
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// serve starts a server for each local backend and returns it with the
+// backend wired to its URL.
+func serve(t *testing.T) map[string]*Local {
+	backends := map[string]*Local{}
+	for name, open := range map[string]func(base string) (*Local, error){
+		"memory": func(base string) (*Local, error) { return NewMemory(base, "secret"), nil },
+		"disk":   func(base string) (*Local, error) { return NewLocal(t.TempDir(), base, "secret") },
+	} {
+		r := chi.NewRouter()
+		srv := httptest.NewServer(r)
+		t.Cleanup(srv.Close)
+		l, err := open(srv.URL + "/storage")
+		if err != nil {
+			t.Fatal(err)
+		}
+		RegisterRoutes(r, l)
+		backends[name] = l
+	}
+	return backends
+}
+
+func do(t *testing.T, req *http.Request) (int, string) {
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	return res.StatusCode, string(body)
+}
+
+func TestLocalPresignedPut(t *testing.T) {
+	ctx := context.Background()
+	for name, l := range serve(t) {
+		signed, err := l.PresignPut(ctx, "users/1/images/a", "image/png", 5, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, _ := http.NewRequest("PUT", signed.URL, strings.NewReader("hello"))
+		req.Header.Set("Content-Type", "image/jpeg")
+		if code, _ := do(t, req); code != http.StatusForbidden {
+			t.Errorf("%s: PUT with another content type: got %d", name, code)
+		}
+		req, _ = http.NewRequest("PUT", signed.URL+"x", strings.NewReader("hello"))
+		req.Header.Set("Content-Type", "image/png")
+		if code, _ := do(t, req); code != http.StatusForbidden {
+			t.Errorf("%s: PUT with a bad signature: got %d", name, code)
+		}
+		req, _ = http.NewRequest("PUT", signed.URL, strings.NewReader("hello"))
+		req.Header.Set("Content-Type", "image/png")
+		if code, body := do(t, req); code != http.StatusOK {
+			t.Fatalf("%s: PUT: got %d %s", name, code, body)
+		}
+
+		o, err := l.Head(ctx, "users/1/images/a")
+		if err != nil || o.Size != 5 || o.ContentType != "image/png" {
+			t.Errorf("%s: Head = %+v, %v", name, o, err)
+		}
+		get, _ := l.PresignGet(ctx, "users/1/images/a", time.Minute)
+		req, _ = http.NewRequest("GET", get, nil)
+		if code, body := do(t, req); code != http.StatusOK || body != "hello" {
+			t.Errorf("%s: GET: got %d %q", name, code, body)
+		}
+	}
+}
+
+func TestLocalPresignedPost(t *testing.T) {
+	ctx := context.Background()
+	for name, l := range serve(t) {
+		signed, err := l.PresignPost(ctx, "users/1/images/b", "image/png", 4, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		post := func(content string) int {
+			var buf bytes.Buffer
+			mw := multipart.NewWriter(&buf)
+			for k, v := range signed.Fields {
+				mw.WriteField(k, v)
+			}
+			fw, _ := mw.CreateFormFile("file", "b.png")
+			fw.Write([]byte(content))
+			mw.Close()
+			req, _ := http.NewRequest("POST", signed.URL, &buf)
+			req.Header.Set("Content-Type", mw.FormDataContentType())
+			code, _ := do(t, req)
+			return code
+		}
+
+		if code := post("too big"); code != http.StatusBadRequest {
+			t.Errorf("%s: POST over the limit: got %d", name, code)
+		}
+		if _, err := l.Head(ctx, "users/1/images/b"); err != ErrNotFound {
+			t.Errorf("%s: rejected POST stored an object: %v", name, err)
+		}
+		if code := post("ok!"); code != http.StatusNoContent {
+			t.Errorf("%s: POST: got %d", name, code)
+		}
+
+		objects, err := l.List(ctx, "users/1/")
+		if err != nil || len(objects) != 1 || objects[0].Key != "users/1/images/b" {
+			t.Errorf("%s: List = %+v, %v", name, objects, err)
+		}
+		if err := l.Delete(ctx, "users/1/images/b", "users/1/missing"); err != nil {
+			t.Errorf("%s: Delete: %v", name, err)
+		}
+		if _, err := l.Get(ctx, "users/1/images/b"); err != ErrNotFound {
+			t.Errorf("%s: Get after Delete: %v", name, err)
+		}
+	}
+}
+
+func TestLocalRejectsBadKeys(t *testing.T) {
+	l := NewMemory("http://localhost/storage", "secret")
+	for _, key := range []string{"../etc/passwd", "/abs", "a//b", ""} {
+		if err := l.Put(context.Background(), key, "text/plain", strings.NewReader("x"), 1); err == nil {
+			t.Errorf("Put(%q) succeeded", key)
+		}
+	}
+}
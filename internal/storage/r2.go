@@ -0,0 +1,189 @@
+// internal/storage/r2.go
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	smithyendpoints "github.com/aws/smithy-go/endpoints"
+	"stringmeup/backend/internal/config"
+)
+
+// R2 takes "auto" wherever S3 wants a region
+const region = "auto"
+
+// r2EndpointResolver routes all S3 calls to Cloudflare R2
+type r2EndpointResolver struct {
+	accountID string
+}
+
+func (r *r2EndpointResolver) ResolveEndpoint(ctx context.Context, params s3.EndpointParameters) (
+	smithyendpoints.Endpoint, error) {
+	return smithyendpoints.Endpoint{
+		URI: *aws.String(fmt.Sprintf("https://%s.r2.cloudflarestorage.com", r.accountID)),
+	}, nil
+}
+
+// R2 stores objects in a Cloudflare R2 bucket through its S3 API.
+type R2 struct {
+	client    *s3.Client
+	presigner *s3.PresignClient
+	bucket    string
+	publicURL string
+}
+
+func NewR2(cfg *config.Config) *R2 {
+	client := s3.New(s3.Options{
+		Region: region,
+		Credentials: credentials.NewStaticCredentialsProvider(
+			cfg.R2AccessKeyID, cfg.R2SecretAccessKey, ""),
+		EndpointResolverV2: &r2EndpointResolver{accountID: cfg.R2AccountID},
+	})
+
+	return &R2{
+		client:    client,
+		presigner: s3.NewPresignClient(client),
+		bucket:    cfg.R2BucketName,
+		publicURL: cfg.R2PublicURL,
+	}
+}
+
+func (s *R2) PresignPut(ctx context.Context, key, contentType string, size int64, ttl time.Duration) (*Request, error) {
+	req, err := s.presigner.PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(size),
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return nil, fmt.Errorf("presign put: %w", err)
+	}
+	return &Request{
+		Method: "PUT",
+		URL:    req.URL,
+		Headers: map[string]string{
+			"Content-Type":   contentType,
+			"Content-Length": strconv.FormatInt(size, 10),
+		},
+	}, nil
+}
+
+// PresignGet caps ttl at seven days, as S3 does.
+func (s *R2) PresignGet(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	req, err := s.presigner.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", fmt.Errorf("presign get: %w", err)
+	}
+	return req.URL, nil
+}
+
+func (s *R2) PublicURL(key string) string {
+	return s.publicURL + "/" + key
+}
+
+func (s *R2) Put(ctx context.Context, key, contentType string, body io.Reader, size int64) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		Body:          body,
+		ContentLength: aws.Int64(size),
+		ContentType:   aws.String(contentType),
+	})
+	if err != nil {
+		return fmt.Errorf("put %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *R2) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	var noKey *types.NoSuchKey
+	if errors.As(err, &noKey) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", key, err)
+	}
+	return out.Body, nil
+}
+
+func (s *R2) Head(ctx context.Context, key string) (*Object, error) {
+	out, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	var notFound *types.NotFound
+	if errors.As(err, &notFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("head %s: %w", key, err)
+	}
+	return &Object{
+		Key:          key,
+		Size:         aws.ToInt64(out.ContentLength),
+		ContentType:  aws.ToString(out.ContentType),
+		LastModified: aws.ToTime(out.LastModified),
+	}, nil
+}
+
+// Delete removes keys in batches of the 1000 S3 allows per request.
+func (s *R2) Delete(ctx context.Context, keys ...string) error {
+	for len(keys) > 0 {
+		n := min(len(keys), 1000)
+		ids := make([]types.ObjectIdentifier, n)
+		for i, k := range keys[:n] {
+			ids[i] = types.ObjectIdentifier{Key: aws.String(k)}
+		}
+		out, err := s.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(s.bucket),
+			Delete: &types.Delete{Objects: ids, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return fmt.Errorf("delete objects: %w", err)
+		}
+		if len(out.Errors) > 0 {
+			e := out.Errors[0]
+			return fmt.Errorf("delete %s: %s", aws.ToString(e.Key), aws.ToString(e.Message))
+		}
+		keys = keys[n:]
+	}
+	return nil
+}
+
+// List leaves ContentType empty; S3 doesn't return it in listings.
+func (s *R2) List(ctx context.Context, prefix string) ([]Object, error) {
+	var objects []Object
+	p := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list %s: %w", prefix, err)
+		}
+		for _, o := range page.Contents {
+			objects = append(objects, Object{
+				Key:          aws.ToString(o.Key),
+				Size:         aws.ToInt64(o.Size),
+				LastModified: aws.ToTime(o.LastModified),
+			})
+		}
+	}
+	return objects, nil
+}
@@ -0,0 +1,82 @@
+// internal/storage/storage.go
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"stringmeup/backend/internal/config"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+type Object struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	LastModified time.Time
+}
+
+// Request is a presigned request a client sends to storage directly.
+type Request struct {
+	Method string
+	URL    string
+	// Fields go in a POST's multipart form, before the file
+	Fields  map[string]string
+	Headers map[string]string
+}
+
+// Storage is an object store. Keys are slash-separated paths such as
+// "users/:id/images/:upload_id".
+type Storage interface {
+	// PresignPut returns a PUT that uploads exactly size bytes of
+	// contentType to key.
+	PresignPut(ctx context.Context, key, contentType string, size int64, ttl time.Duration) (*Request, error)
+	// PresignGet returns a URL that downloads key until ttl passes.
+	PresignGet(ctx context.Context, key string, ttl time.Duration) (string, error)
+	// PublicURL returns the unsigned URL of key. It only works when the
+	// bucket allows public reads.
+	PublicURL(key string) string
+
+	// Put uploads body to key. size must be the exact length of body.
+	Put(ctx context.Context, key, contentType string, body io.Reader, size int64) error
+	// Get opens the object at key. The caller must close the returned body.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Head(ctx context.Context, key string) (*Object, error)
+	// Delete removes keys. Missing keys are not an error.
+	Delete(ctx context.Context, keys ...string) error
+	// List returns every object whose key starts with prefix.
+	List(ctx context.Context, prefix string) ([]Object, error)
+}
+
+// PostPresigner is a Storage that accepts browser-style POST uploads. R2
+// doesn't support POST policies, so only the local backends implement it.
+type PostPresigner interface {
+	// PresignPost returns a multipart POST that uploads between 1 and
+	// maxBytes of contentType to key.
+	PresignPost(ctx context.Context, key, contentType string, maxBytes int64, ttl time.Duration) (*Request, error)
+}
+
+// New returns the backend named by STORAGE_BACKEND.
+func New(cfg *config.Config) (Storage, error) {
+	switch cfg.StorageBackend {
+	case "r2":
+		return NewR2(cfg), nil
+	case "local":
+		l, err := NewLocal(cfg.LocalStorageDir, cfg.StorageURL, cfg.StorageSigningSecret)
+		if err != nil {
+			return nil, err
+		}
+		l.private = cfg.StoragePrivate
+		return l, nil
+	case "memory":
+		l := NewMemory(cfg.StorageURL, cfg.StorageSigningSecret)
+		l.private = cfg.StoragePrivate
+		return l, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.StorageBackend)
+	}
+}
@@ -0,0 +1,91 @@
+// internal/units/units.go
+package units
+
+import (
+	"fmt"
+	"math"
+)
+
+// System is a user's preferred unit system, from the "units" preference.
+type System string
+
+const (
+	Metric   System = "metric"
+	Imperial System = "imperial"
+)
+
+type Unit string
+
+const (
+	MM Unit = "mm"
+	CM Unit = "cm"
+	M  Unit = "m"
+	In Unit = "in"
+	Ft Unit = "ft"
+)
+
+var mmPer = map[Unit]float64{MM: 1, CM: 10, M: 1000, In: 25.4, Ft: 304.8}
+
+// Length is a value with an explicit unit, as accepted and returned by the
+// API: {"value": 30, "unit": "cm"}.
+type Length struct {
+	Value float64 `json:"value"`
+	Unit  Unit    `json:"unit"`
+}
+
+func Inches(v float64) Length      { return Length{Value: v, Unit: In} }
+func Millimetres(v float64) Length { return Length{Value: v, Unit: MM} }
+
+func (l Length) MM() float64     { return l.Value * mmPer[l.Unit] }
+func (l Length) Inches() float64 { return l.MM() / mmPer[In] }
+
+// To converts l to u, rounded for display.
+func (l Length) To(u Unit) Length {
+	v := l.MM() / mmPer[u]
+	return Length{Value: math.Round(v*100) / 100, Unit: u}
+}
+
+// String renders l for plain-text output, e.g. `30 cm` or `12"`.
+func (l Length) String() string {
+	if l.Unit == In {
+		return fmt.Sprintf("%g\"", l.Value)
+	}
+	return fmt.Sprintf("%g %s", l.Value, l.Unit)
+}
+
+// SizeUnit is the unit a system shows piece sizes in.
+func SizeUnit(s System) Unit {
+	if s == Imperial {
+		return In
+	}
+	return CM
+}
+
+// DiameterUnit is the unit a system shows nail diameters in.
+func DiameterUnit(s System) Unit {
+	if s == Imperial {
+		return In
+	}
+	return MM
+}
+
+// Parse reads a length from decoded JSON: either {"value": n, "unit": u},
+// or a bare number taken to be in fallback.
+func Parse(v any, fallback Unit) (Length, error) {
+	switch v := v.(type) {
+	case float64:
+		return Length{Value: v, Unit: fallback}, nil
+	case map[string]any:
+		value, ok := v["value"].(float64)
+		if !ok {
+			return Length{}, fmt.Errorf("value must be a number")
+		}
+		unit, _ := v["unit"].(string)
+		if _, ok := mmPer[Unit(unit)]; !ok {
+			return Length{}, fmt.Errorf("unit must be one of mm, cm, m, in, ft")
+		}
+		return Length{Value: value, Unit: Unit(unit)}, nil
+	default:
+		return Length{}, fmt.Errorf(`must be a number or {"value": n, "unit": u}`)
+	}
+}
@@ -0,0 +1,94 @@
+// internal/units/units_test.go
+package units
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	cases := []struct {
+		from Length
+		to   Unit
+		want float64
+	}{
+		{Inches(1), CM, 2.54},
+		{Inches(1), MM, 25.4},
+		{Inches(12), Ft, 1},
+		{Length{30, CM}, In, 11.81},
+		{Length{30, CM}, MM, 300},
+		{Millimetres(3), CM, 0.3},
+		{Millimetres(3), In, 0.12},
+		{Length{1.5, M}, CM, 150},
+		{Inches(-2), CM, -5.08},
+		{Length{0, CM}, In, 0},
+	}
+	for _, c := range cases {
+		got := c.from.To(c.to)
+		if got.Unit != c.to || got.Value != c.want {
+			t.Errorf("%v to %s = %v, want %g %s", c.from, c.to, got, c.want, c.to)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	// Converting through millimetres and back loses nothing beyond float
+	// error; only To rounds
+	units := []Unit{MM, CM, M, In, Ft}
+	for _, v := range []float64{1, 12.7, 30, -4.5} {
+		for _, from := range units {
+			for _, via := range units {
+				l := Length{v, from}
+				mid := Length{l.MM() / mmPer[via], via}
+				back := mid.MM() / mmPer[from]
+				if math.Abs(back-v) > 1e-9 {
+					t.Errorf("%g %s via %s = %g", v, from, via, back)
+				}
+			}
+		}
+	}
+	if got := Inches(10).To(CM).To(In); got != Inches(10) {
+		t.Errorf("10in to cm and back = %v", got)
+	}
+	if got := Millimetres(4).To(In).Inches(); math.Abs(got-0.16) > 1e-9 {
+		t.Errorf("4mm in inches = %g, want 0.16", got)
+	}
+}
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		json     string
+		fallback Unit
+		want     Length
+		wantErr  bool
+	}{
+		{`30`, CM, Length{30, CM}, false},
+		{`12`, In, Inches(12), false},
+		{`-3`, MM, Millimetres(-3), false},
+		{`{"value": 30, "unit": "cm"}`, In, Length{30, CM}, false},
+		{`{"value": 1.5, "unit": "ft"}`, CM, Length{1.5, Ft}, false},
+		{`{"value": -2.5, "unit": "in"}`, CM, Inches(-2.5), false},
+		{`{"value": 30, "unit": "yd"}`, CM, Length{}, true},
+		{`{"value": 30, "unit": "CM"}`, CM, Length{}, true},
+		{`{"value": 30}`, CM, Length{}, true},
+		{`{"value": "30", "unit": "cm"}`, CM, Length{}, true},
+		{`{"unit": "cm"}`, CM, Length{}, true},
+		{`"30cm"`, CM, Length{}, true},
+		{`null`, CM, Length{}, true},
+	}
+	for _, c := range cases {
+		var v any
+		if err := json.Unmarshal([]byte(c.json), &v); err != nil {
+			t.Fatal(err)
+		}
+		got, err := Parse(v, c.fallback)
+		if (err != nil) != c.wantErr {
+			t.Errorf("Parse(%s) error = %v, want error %v", c.json, err, c.wantErr)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("Parse(%s) = %+v, want %+v", c.json, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+// internal/uploads/adjusted.go
+package uploads
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"stringmeup/backend/internal/imaging"
+	"stringmeup/backend/internal/storage"
+)
+
+// ErrUnsupported is returned when an image can't be decoded to adjust it.
+var ErrUnsupported = errors.New("image type can't be adjusted yet")
+
+// adjustedKeyRe matches adjusted working copies; capture 1 is the upload ID
+// and capture 2 the adjustment hash.
+var adjustedKeyRe = regexp.MustCompile(`^users/[^/]+/derived/([^/]+)/work_[a-z]+_([0-9a-f]+)\.png$`)
+
+// adjustmentHash identifies shape with a applied. It hashes everything that
+// affects the pixels, so equal adjustments share a copy and a change to the
+// pipeline doesn't serve stale ones.
+func adjustmentHash(shape string, a imaging.Adjustments) string {
+	spec, _ := json.Marshal(a)
+	sum := sha256.Sum256(fmt.Appendf(nil, "%d:%s:%s", imaging.AdjustVersion, shape, spec))
+	return fmt.Sprintf("%x", sum[:8])
+}
+
+func adjustedWorkName(shape, hash string) string { return fmt.Sprintf("work_%s_%s.png", shape, hash) }
+
+func adjustedThumbName(size int, hash string) string {
+	return fmt.Sprintf("thumb_%d_%s.jpg", size, hash)
+}
+
+// adjustedThumbKeys returns the keys of the preview thumbnails made with the
+// working copy at key, keyed by size, or nil if key isn't adjusted.
+func adjustedThumbKeys(key string) map[string]string {
+	m := adjustedKeyRe.FindStringSubmatch(key)
+	if m == nil {
+		return nil
+	}
+	dir := key[:strings.LastIndex(key, "/")+1]
+	keys := make(map[string]string, len(ThumbnailSizes))
+	for _, size := range ThumbnailSizes {
+		keys[strconv.Itoa(size)] = dir + adjustedThumbName(size, m[2])
+	}
+	return keys
+}
+
+// AdjustedThumbnails returns the URLs of the preview thumbnails made with
+// the adjusted working copy at key, keyed by size like Derivatives.
+func (s *Service) AdjustedThumbnails(key string) map[string]string {
+	keys := adjustedThumbKeys(key)
+	if keys == nil {
+		return nil
+	}
+	urls := make(map[string]string, len(keys))
+	for size, k := range keys {
+		urls[size] = s.URL(k)
+	}
+	return urls
+}
+
+// AdjustedKey returns the key Adjusted stores u's working copy for shape
+// with a applied under, without rendering it.
+func AdjustedKey(u *Upload, shape string, a imaging.Adjustments) string {
+	if !slices.Contains(WorkShapes, shape) {
+		shape = "square"
+	}
+	return DerivativeKey(u.userID, u.ID, adjustedWorkName(shape, adjustmentHash(shape, a)))
+}
+
+// Adjusted returns the key of u's working copy for a board of shape with a
+// applied, rendering it from the original the first time along with
+// preview thumbnails scaled down from it. The copies count towards the
+// owner's storage like the upload's other derivatives.
+func (s *Service) Adjusted(ctx context.Context, u *Upload, shape string, a imaging.Adjustments) (string, error) {
+	if !slices.Contains(WorkShapes, shape) {
+		shape = "square"
+	}
+	hash := adjustmentHash(shape, a)
+	key := DerivativeKey(u.userID, u.ID, adjustedWorkName(shape, hash))
+
+	// Render whatever is missing, e.g. thumbnails of a copy made before
+	// previews were
+	var missing []int
+	for _, size := range ThumbnailSizes {
+		ok, err := s.exists(ctx, DerivativeKey(u.userID, u.ID, adjustedThumbName(size, hash)))
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			missing = append(missing, size)
+		}
+	}
+	workExists, err := s.exists(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	if workExists && len(missing) == 0 {
+		return key, nil
+	}
+
+	base, err := s.decodeBase(ctx, u.objectKey)
+	if errors.Is(err, image.ErrFormat) {
+		return "", ErrUnsupported
+	}
+	if err != nil {
+		return "", err
+	}
+	work := imaging.Adjust(base, a, workSize, shape == "circle")
+	var stored int64
+	defer func() {
+		if stored > 0 {
+			s.countDerived(ctx, u.ID, u.userID, stored)
+		}
+	}()
+	put := func(name, contentType string, out *bytes.Buffer) error {
+		n := int64(out.Len())
+		if err := s.Put(ctx, DerivativeKey(u.userID, u.ID, name), contentType, out, n); err != nil {
+			return err
+		}
+		stored += n
+		return nil
+	}
+
+	for _, size := range missing {
+		var out bytes.Buffer
+		if err := jpeg.Encode(&out, imaging.Fit(work, size), &jpeg.Options{Quality: 82}); err != nil {
+			return "", err
+		}
+		if err := put(adjustedThumbName(size, hash), "image/jpeg", &out); err != nil {
+			return "", err
+		}
+	}
+	if !workExists {
+		var out bytes.Buffer
+		if err := png.Encode(&out, work); err != nil {
+			return "", err
+		}
+		if err := put(adjustedWorkName(shape, hash), "image/png", &out); err != nil {
+			return "", err
+		}
+	}
+	return key, nil
+}
+
+// exists reports whether an object is stored at key.
+func (s *Service) exists(ctx context.Context, key string) (bool, error) {
+	_, err := s.store.Head(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// DropAdjusted deletes an adjusted working copy made by Adjusted, and its
+// preview thumbnails, and stops counting them. Callers check no project
+// still uses it.
+func (s *Service) DropAdjusted(ctx context.Context, key string) error {
+	m := adjustedKeyRe.FindStringSubmatch(key)
+	if m == nil {
+		return fmt.Errorf("%s is not an adjusted working copy", key)
+	}
+	keys := []string{key}
+	for _, k := range adjustedThumbKeys(key) {
+		keys = append(keys, k)
+	}
+	var size int64
+	stored := []string{}
+	for _, k := range keys {
+		head, err := s.store.Head(ctx, k)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		size += head.Size
+		stored = append(stored, k)
+	}
+	if len(stored) == 0 {
+		return nil
+	}
+	if err := s.Delete(ctx, stored...); err != nil {
+		return err
+	}
+	var userID string
+	if err := s.db.QueryRow(ctx, `SELECT user_id FROM uploads WHERE id = $1`, m[1]).Scan(&userID); err != nil {
+		return err
+	}
+	s.countDerived(ctx, m[1], userID, -size)
+	return nil
+}
+
+// countDerived adds n bytes of derivatives to a complete upload and its
+// owner's usage. Uploads deleted meanwhile were already uncounted.
+func (s *Service) countDerived(ctx context.Context, uploadID, userID string, n int64) {
+	tag, err := s.db.Exec(ctx,
+		`UPDATE uploads SET derived_bytes = GREATEST(derived_bytes + $1, 0)
+		 WHERE id = $2 AND status = 'complete'`, n, uploadID)
+	if err == nil && tag.RowsAffected() > 0 {
+		err = s.addUsage(ctx, userID, n)
+	}
+	if err != nil {
+		log.Printf("uploads: count derived %s: %v", uploadID, err)
+	}
+}
@@ -0,0 +1,231 @@
+// internal/uploads/chunked.go
+package uploads
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"stringmeup/backend/internal/storage"
+)
+
+const (
+	// MaxChunkBytes is the most a client may send in one chunk.
+	MaxChunkBytes = 8 << 20
+	// Chunked uploads stay open this long, so clients can resume after a
+	// dropped connection
+	chunkedTTL = 24 * time.Hour
+)
+
+var (
+	ErrNotChunked    = errors.New("upload is not chunked")
+	ErrUploadExpired = errors.New("upload has expired")
+)
+
+// OffsetError is returned when a chunk doesn't start where the received
+// bytes end. The client resumes by sending from Received.
+type OffsetError struct {
+	Received int64
+}
+
+func (e *OffsetError) Error() string {
+	return fmt.Sprintf("expected chunk at offset %d", e.Received)
+}
+
+// chunkKey is where one attempt at the chunk at offset is kept until the
+// upload is assembled. Every attempt gets its own key, so one that loses
+// the race to claim the offset can't overwrite the one that won.
+func chunkKey(userID, uploadID string, offset int64) string {
+	return fmt.Sprintf("users/%s/chunks/%s/%016d-%s", userID, uploadID, offset, uuid.New())
+}
+
+func (s *Service) startChunked(ctx context.Context, id, userID, key string, req PresignRequest, maxBytes int64) (*PresignResult, error) {
+	if err := s.insertUpload(ctx, id, userID, key, req.ContentType, &req.Size); err != nil {
+		return nil, err
+	}
+	expires := time.Now().UTC().Add(chunkedTTL)
+	return &PresignResult{
+		ID:         id,
+		Method:     "chunked",
+		URL:        "/v1/uploads/" + id + "/chunks",
+		Key:        s.publicKey(key),
+		MaxBytes:   maxBytes,
+		ChunkBytes: MaxChunkBytes,
+		ExpiresAt:  &expires,
+	}, nil
+}
+
+// PutChunk stores the next chunk of a chunked upload, which must start at
+// the upload's ReceivedBytes. The chunks are kept in storage rather than on
+// this instance, so a client can resume against any of them. Once the last
+// chunk arrives they are joined into the image and the upload is
+// completed; sending the last chunk again returns the completed upload.
+func (s *Service) PutChunk(ctx context.Context, id, userID string, offset int64, chunk io.Reader) (*Upload, error) {
+	u, err := s.GetUpload(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if u.TotalBytes == nil {
+		return nil, ErrNotChunked
+	}
+	switch u.Status {
+	case "complete":
+		return u, nil
+	case "pending":
+	default:
+		return nil, ErrUploadNotFound
+	}
+	if time.Since(u.CreatedAt) > chunkedTTL {
+		return nil, ErrUploadExpired
+	}
+	total := *u.TotalBytes
+	if u.ReceivedBytes == total {
+		// Every chunk arrived but joining them failed; try again
+		return s.assemble(ctx, u)
+	}
+	if offset != u.ReceivedBytes {
+		return nil, &OffsetError{Received: u.ReceivedBytes}
+	}
+
+	data, err := io.ReadAll(io.LimitReader(chunk, MaxChunkBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("read chunk: %w", err)
+	}
+	size := int64(len(data))
+	switch {
+	case size == 0:
+		return nil, FieldErrors{"chunk": "is empty"}
+	case size > MaxChunkBytes:
+		return nil, FieldErrors{"chunk": fmt.Sprintf("must be at most %d MB", MaxChunkBytes>>20)}
+	case offset+size > total:
+		return nil, FieldErrors{"chunk": fmt.Sprintf("runs past the declared size of %d bytes", total)}
+	}
+	// Catch the wrong kind of file before the rest of it is sent
+	if offset == 0 {
+		if got := sniff(data); got != u.ContentType {
+			return nil, s.reject(ctx, u, fmt.Sprintf("content looks like %s, not %s", got, u.ContentType))
+		}
+	}
+
+	key := chunkKey(u.userID, u.ID, offset)
+	if err := s.Put(ctx, key, "application/octet-stream", bytes.NewReader(data), size); err != nil {
+		return nil, err
+	}
+	tag, err := s.db.Exec(ctx,
+		`UPDATE uploads SET received_bytes = $1, chunk_keys = array_append(chunk_keys, $4)
+		 WHERE id = $2 AND status = 'pending' AND received_bytes = $3`, offset+size, id, offset, key)
+	if err != nil || tag.RowsAffected() == 0 {
+		if delErr := s.Delete(ctx, key); delErr != nil {
+			// Left for the collector
+			log.Printf("uploads: delete chunk %s: %v", key, delErr)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		// Another request claimed this chunk first
+		cur, err := s.GetUpload(ctx, id, userID)
+		if err != nil {
+			return nil, err
+		}
+		return nil, &OffsetError{Received: cur.ReceivedBytes}
+	}
+	u.ReceivedBytes = offset + size
+	if u.ReceivedBytes < total {
+		return u, nil
+	}
+	return s.assemble(ctx, u)
+}
+
+// assemble joins a fully received upload's recorded chunks into its image,
+// removes every chunk stored for it and completes the upload.
+func (s *Service) assemble(ctx context.Context, u *Upload) (*Upload, error) {
+	var keys []string
+	if err := s.db.QueryRow(ctx, `SELECT chunk_keys FROM uploads WHERE id = $1`, u.ID).Scan(&keys); err != nil {
+		return nil, err
+	}
+	chunks, err := s.store.List(ctx, fmt.Sprintf("users/%s/chunks/%s/", u.userID, u.ID))
+	if err != nil {
+		return nil, err
+	}
+	sizes := make(map[string]int64, len(chunks))
+	stored := make([]string, len(chunks))
+	for i, c := range chunks {
+		sizes[c.Key] = c.Size
+		stored[i] = c.Key
+	}
+	var size int64
+	for _, k := range keys {
+		n, ok := sizes[k]
+		if !ok {
+			return nil, fmt.Errorf("assemble %s: chunk %s is missing", u.ID, k)
+		}
+		size += n
+	}
+	if size != *u.TotalBytes {
+		return nil, fmt.Errorf("assemble %s: chunks hold %d of %d bytes", u.ID, size, *u.TotalBytes)
+	}
+
+	r := &chunkReader{ctx: ctx, store: s.store, keys: keys}
+	tmp, _, err := spool(r, size)
+	r.Close()
+	if err != nil {
+		return nil, err
+	}
+	defer closeSpool(tmp)
+	if err := s.Put(ctx, u.objectKey, u.ContentType, tmp, size); err != nil {
+		return nil, err
+	}
+	if err := s.Delete(ctx, stored...); err != nil {
+		// Left for the collector
+		log.Printf("uploads: delete chunks of %s: %v", u.ID, err)
+	}
+	return s.Complete(ctx, u.ID, u.userID)
+}
+
+// chunkReader reads the objects at keys one after another, opening each
+// only once the one before it is used up.
+type chunkReader struct {
+	ctx   context.Context
+	store storage.Storage
+	keys  []string
+	cur   io.ReadCloser
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.cur == nil {
+			if len(r.keys) == 0 {
+				return 0, io.EOF
+			}
+			body, err := r.store.Get(r.ctx, r.keys[0])
+			if err != nil {
+				return 0, err
+			}
+			r.cur, r.keys = body, r.keys[1:]
+		}
+		n, err := r.cur.Read(p)
+		if err == io.EOF {
+			r.cur.Close()
+			r.cur = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (r *chunkReader) Close() error {
+	if r.cur == nil {
+		return nil
+	}
+	return r.cur.Close()
+}
@@ -0,0 +1,228 @@
+// internal/uploads/derivatives.go
+package uploads
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"stringmeup/backend/internal/imaging"
+)
+
+// Processing states of a completed upload.
+const (
+	ProcessingPending     = "pending"
+	ProcessingReady       = "ready"
+	ProcessingFailed      = "failed"
+	ProcessingUnsupported = "unsupported" // no decoder for the type
+)
+
+// ThumbnailSizes are the longest sides, in pixels, of the JPEG thumbnails
+// made for each upload.
+var ThumbnailSizes = []int{160, 480, 1080}
+
+// WorkShapes are the board shapes a working copy is made for. Projects of
+// any other shape use the square one.
+var WorkShapes = []string{"circle", "square"}
+
+const (
+	// workSize is the side of the grayscale working copies
+	workSize = 1024
+	// Photos are scaled down to baseSize before anything else, so only one
+	// pass touches every pixel of the original
+	baseSize = 2048
+	// Larger images are refused before decoding
+	maxPixels = 50_000_000
+)
+
+// Derivatives links an upload's processed images.
+type Derivatives struct {
+	// Keyed by size, e.g. "480"
+	Thumbnails map[string]string `json:"thumbnails"`
+	// Keyed by shape
+	Working map[string]string `json:"working"`
+}
+
+// WorkingFor returns the working copy to use for a board of shape.
+func (d *Derivatives) WorkingFor(shape string) string {
+	if u, ok := d.Working[shape]; ok {
+		return u
+	}
+	return d.Working["square"]
+}
+
+// DerivativeKey is where the derivative name of an upload is stored, e.g.
+// "thumb_480.jpg" or "work_circle.png".
+func DerivativeKey(userID, uploadID, name string) string {
+	return fmt.Sprintf("users/%s/derived/%s/%s", userID, uploadID, name)
+}
+
+func thumbName(size int) string { return fmt.Sprintf("thumb_%d.jpg", size) }
+
+func workName(shape string) string { return "work_" + shape + ".png" }
+
+// Derivatives returns the URLs of an upload's derivatives. It doesn't check
+// they exist; callers only use it once processing is ready.
+func (s *Service) Derivatives(userID, uploadID string) *Derivatives {
+	d := &Derivatives{Thumbnails: map[string]string{}, Working: map[string]string{}}
+	for _, size := range ThumbnailSizes {
+		d.Thumbnails[strconv.Itoa(size)] = s.URL(DerivativeKey(userID, uploadID, thumbName(size)))
+	}
+	for _, shape := range WorkShapes {
+		d.Working[shape] = s.URL(DerivativeKey(userID, uploadID, workName(shape)))
+	}
+	return d
+}
+
+// Run processes completed uploads until ctx is cancelled. Complete wakes it
+// so derivatives usually exist within seconds.
+func (s *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		for {
+			u, userID, err := s.claim(ctx)
+			if err != nil {
+				if !errors.Is(err, pgx.ErrNoRows) {
+					log.Printf("uploads: claim: %v", err)
+				}
+				break
+			}
+			state := ProcessingReady
+			size, err := s.process(ctx, u, userID)
+			if errors.Is(err, image.ErrFormat) {
+				state = ProcessingUnsupported
+			} else if err != nil {
+				log.Printf("uploads: process %s: %v", u.ID, err)
+				state = ProcessingFailed
+			}
+			s.finish(ctx, u.ID, userID, state, size)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// claim picks the oldest unprocessed upload. Uploads stuck processing for
+// ten minutes belonged to an instance that died and are retried.
+func (s *Service) claim(ctx context.Context) (*Upload, string, error) {
+	var userID string
+	u := &Upload{}
+	err := s.db.QueryRow(ctx,
+		`UPDATE uploads SET processing = 'processing', processing_started_at = NOW()
+		 WHERE id = (
+		   SELECT id FROM uploads
+		   WHERE status = 'complete' AND (processing = 'pending'
+		      OR (processing = 'processing' AND processing_started_at < NOW() - INTERVAL '10 minutes'))
+		   ORDER BY completed_at LIMIT 1
+		   FOR UPDATE SKIP LOCKED)
+		 RETURNING id, user_id, object_key, content_type`,
+	).Scan(&u.ID, &userID, &u.objectKey, &u.ContentType)
+	if err != nil {
+		return nil, "", err
+	}
+	return u, userID, nil
+}
+
+// finish records the outcome of processing and counts any derivatives
+// stored towards the user's quota, even if processing then failed.
+func (s *Service) finish(ctx context.Context, id, userID, state string, derivedBytes int64) {
+	_, err := s.db.Exec(ctx,
+		`UPDATE uploads SET processing = $1, derived_bytes = $2 WHERE id = $3`, state, derivedBytes, id)
+	if err != nil {
+		log.Printf("uploads: finish %s: %v", id, err)
+		return
+	}
+	if err := s.addUsage(ctx, userID, derivedBytes); err != nil {
+		log.Printf("uploads: count %s: %v", id, err)
+	}
+}
+
+// decodeBase decodes the original at key, scaled to baseSize and turned
+// upright. Re-encoding anything made from it drops the EXIF block, so
+// location and camera details never reach a derivative.
+func (s *Service) decodeBase(ctx context.Context, key string) (*image.RGBA, error) {
+	body, err := s.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("read original: %w", err)
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, fmt.Errorf("%dx%d is too large to process", cfg.Width, cfg.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+	return imaging.Orient(imaging.Fit(img, baseSize), imaging.Orientation(data)), nil
+}
+
+// process decodes the original and stores its derivatives, returning the
+// bytes stored.
+func (s *Service) process(ctx context.Context, u *Upload, userID string) (int64, error) {
+	base, err := s.decodeBase(ctx, u.objectKey)
+	if err != nil {
+		return 0, err
+	}
+
+	var stored int64
+	put := func(name, contentType string, out *bytes.Buffer) error {
+		n := int64(out.Len())
+		if err := s.Put(ctx, DerivativeKey(userID, u.ID, name), contentType, out, n); err != nil {
+			return err
+		}
+		stored += n
+		return nil
+	}
+
+	for _, size := range ThumbnailSizes {
+		var out bytes.Buffer
+		if err := jpeg.Encode(&out, imaging.Fit(base, size), &jpeg.Options{Quality: 82}); err != nil {
+			return stored, err
+		}
+		if err := put(thumbName(size), "image/jpeg", &out); err != nil {
+			return stored, err
+		}
+	}
+
+	square := imaging.Gray(imaging.Square(base, workSize))
+	for _, shape := range WorkShapes {
+		work := square
+		if shape == "circle" {
+			work = image.NewGray(square.Rect)
+			copy(work.Pix, square.Pix)
+			imaging.MaskCircle(work)
+		}
+		var out bytes.Buffer
+		if err := png.Encode(&out, work); err != nil {
+			return stored, err
+		}
+		if err := put(workName(shape), "image/png", &out); err != nil {
+			return stored, err
+		}
+	}
+	return stored, nil
+}
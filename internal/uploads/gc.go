@@ -0,0 +1,280 @@
+// internal/uploads/gc.go
+package uploads
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// imageKeyRe matches original images; capture 1 is the user ID and 2 the
+// upload ID.
+var imageKeyRe = regexp.MustCompile(`^users/([^/]+)/images/([^/]+)$`)
+
+// chunkKeyRe matches the chunks of a chunked upload still being received.
+var chunkKeyRe = regexp.MustCompile(`^users/[^/]+/chunks/`)
+
+// markerKeyRe finds image keys in progress marker labels and notes, which
+// users sometimes paste image links into.
+var markerKeyRe = regexp.MustCompile(`users/[0-9a-f-]{36}/images/[0-9a-f-]{36}`)
+
+// Orphans listed in a report, beyond which only the totals are kept
+const maxReportedOrphans = 1000
+
+type GCRun struct {
+	ID             string     `json:"id"`
+	DryRun         bool       `json:"dry_run"`
+	ObjectsScanned int        `json:"objects_scanned"`
+	BytesScanned   int64      `json:"bytes_scanned"`
+	Orphans        int        `json:"orphans"`
+	OrphanBytes    int64      `json:"orphan_bytes"`
+	Deleted        int        `json:"deleted"`
+	ReclaimedBytes int64      `json:"reclaimed_bytes"`
+	Error          string     `json:"error"`
+	StartedAt      time.Time  `json:"started_at"`
+	FinishedAt     *time.Time `json:"finished_at"`
+}
+
+// GCReport is a run with the orphans it found.
+type GCReport struct {
+	GCRun
+	OrphanObjects []GCObject `json:"orphan_objects"`
+}
+
+type GCObject struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// RunGC collects unreferenced images every UploadGCInterval until ctx is
+// cancelled.
+func (s *Service) RunGC(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.UploadGCInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r, err := s.CollectGarbage(ctx, s.cfg.UploadGCDryRun)
+			if err != nil {
+				log.Printf("uploads: gc: %v", err)
+				continue
+			}
+			log.Printf("uploads: gc: %d of %d objects orphaned, %d deleted, %d bytes reclaimed (dry run: %t)",
+				r.Orphans, r.ObjectsScanned, r.Deleted, r.ReclaimedBytes, r.DryRun)
+		}
+	}
+}
+
+// CollectGarbage deletes original images under users/*/images/ that no
+// project or progress marker refers to, with their derivatives, and the
+// chunks of abandoned chunked uploads. Objects younger than UploadGCGrace
+// are left alone, since they may belong to an upload still in progress or
+// about to be attached. A dry run only reports what would go.
+func (s *Service) CollectGarbage(ctx context.Context, dryRun bool) (*GCReport, error) {
+	r := &GCReport{GCRun: GCRun{DryRun: dryRun}, OrphanObjects: []GCObject{}}
+	err := s.db.QueryRow(ctx,
+		`INSERT INTO upload_gc_runs (dry_run) VALUES ($1) RETURNING id, started_at`, dryRun,
+	).Scan(&r.ID, &r.StartedAt)
+	if err != nil {
+		return nil, fmt.Errorf("record gc run: %w", err)
+	}
+
+	err = s.collect(ctx, r)
+	if err != nil {
+		r.Error = err.Error()
+	}
+	now := time.Now().UTC()
+	r.FinishedAt = &now
+	if _, dbErr := s.db.Exec(ctx,
+		`UPDATE upload_gc_runs
+		 SET objects_scanned = $1, bytes_scanned = $2, orphans = $3, orphan_bytes = $4,
+		     deleted = $5, reclaimed_bytes = $6, error = $7, finished_at = $8
+		 WHERE id = $9`,
+		r.ObjectsScanned, r.BytesScanned, r.Orphans, r.OrphanBytes,
+		r.Deleted, r.ReclaimedBytes, r.Error, now, r.ID); dbErr != nil {
+		log.Printf("uploads: gc: record run %s: %v", r.ID, dbErr)
+	}
+	return r, err
+}
+
+func (s *Service) collect(ctx context.Context, r *GCReport) error {
+	refs, err := s.referencedKeys(ctx)
+	if err != nil {
+		return err
+	}
+	objects, err := s.store.List(ctx, "users/")
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().Add(-s.cfg.UploadGCGrace)
+	for _, o := range objects {
+		m := imageKeyRe.FindStringSubmatch(o.Key)
+		chunk := m == nil && chunkKeyRe.MatchString(o.Key)
+		if m == nil && !chunk {
+			continue
+		}
+		r.ObjectsScanned++
+		r.BytesScanned += o.Size
+		// Chunked uploads expire well within the grace period, so any chunk
+		// older than it was abandoned
+		if refs[o.Key] || o.LastModified.After(cutoff) {
+			continue
+		}
+
+		r.Orphans++
+		r.OrphanBytes += o.Size
+		if len(r.OrphanObjects) < maxReportedOrphans {
+			r.OrphanObjects = append(r.OrphanObjects, GCObject{Key: o.Key, Size: o.Size, LastModified: o.LastModified})
+		}
+		if r.DryRun {
+			continue
+		}
+		var reclaimed int64
+		if chunk {
+			err = s.store.Delete(ctx, o.Key)
+			reclaimed = o.Size
+		} else {
+			reclaimed, err = s.deleteOrphan(ctx, o.Key, m[1], m[2])
+		}
+		if err != nil {
+			return err
+		}
+		if reclaimed > 0 {
+			r.Deleted++
+			r.ReclaimedBytes += reclaimed
+		}
+	}
+	return nil
+}
+
+// referencedKeys returns the key of every image a project or progress
+// marker points at.
+func (s *Service) referencedKeys(ctx context.Context) (map[string]bool, error) {
+	refs := map[string]bool{}
+	rows, err := s.db.Query(ctx,
+		`SELECT p.user_id, u.object_key FROM projects p JOIN uploads u ON u.id = p.image_upload_id
+		 UNION
+		 SELECT user_id, image_remote_url FROM projects WHERE image_remote_url <> '' AND image_upload_id IS NULL`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var ownerID, ref string
+		if err := rows.Scan(&ownerID, &ref); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		// Projects from before uploads were recorded only have the URL
+		if key, ok := s.StoredKey(ownerID, ref); ok {
+			refs[key] = true
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.Query(ctx,
+		`SELECT label || ' ' || note FROM progress_markers
+		 WHERE label LIKE '%/images/%' OR note LIKE '%/images/%'`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var text string
+		if err := rows.Scan(&text); err != nil {
+			return nil, err
+		}
+		for _, key := range markerKeyRe.FindAllString(text, -1) {
+			refs[key] = true
+		}
+	}
+	return refs, rows.Err()
+}
+
+// deleteOrphan removes an image and its derivatives and returns the bytes
+// freed. The upload is marked deleted first, unless a project has attached
+// it since the references were read, in which case nothing is deleted. An
+// upload that still counts references is kept too, in case the count is
+// right and the scan missed something.
+func (s *Service) deleteOrphan(ctx context.Context, key, userID, uploadID string) (int64, error) {
+	var recorded bool
+	err := s.db.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM uploads WHERE object_key = $1)`, key).Scan(&recorded)
+	if err != nil {
+		return 0, err
+	}
+	if recorded {
+		var prevStatus string
+		var counted int64
+		err := s.db.QueryRow(ctx,
+			`UPDATE uploads u SET status = 'deleted'
+			 FROM (SELECT id, status FROM uploads WHERE object_key = $1 FOR UPDATE) prev
+			 WHERE u.id = prev.id AND u.ref_count = 0
+			   AND NOT EXISTS (SELECT 1 FROM projects WHERE image_upload_id = u.id)
+			 RETURNING prev.status, u.size_bytes + u.derived_bytes`, key).Scan(&prevStatus, &counted)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if prevStatus == "complete" {
+			if err := s.addUsage(ctx, userID, -counted); err != nil {
+				log.Printf("uploads: gc: uncount %s: %v", key, err)
+			}
+		}
+	}
+
+	derived, err := s.store.List(ctx, DerivativeKey(userID, uploadID, ""))
+	if err != nil {
+		return 0, err
+	}
+	keys := []string{key}
+	var size int64
+	for _, o := range derived {
+		keys = append(keys, o.Key)
+		size += o.Size
+	}
+	head, err := s.store.Head(ctx, key)
+	if err == nil {
+		size += head.Size
+	}
+	if err := s.store.Delete(ctx, keys...); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// GCRuns returns the most recent collections, newest first.
+func (s *Service) GCRuns(ctx context.Context, limit int) ([]GCRun, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT id, dry_run, objects_scanned, bytes_scanned, orphans, orphan_bytes,
+		        deleted, reclaimed_bytes, error, started_at, finished_at
+		 FROM upload_gc_runs ORDER BY started_at DESC LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []GCRun{}
+	for rows.Next() {
+		var r GCRun
+		if err := rows.Scan(&r.ID, &r.DryRun, &r.ObjectsScanned, &r.BytesScanned, &r.Orphans,
+			&r.OrphanBytes, &r.Deleted, &r.ReclaimedBytes, &r.Error, &r.StartedAt, &r.FinishedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
@@ -3,27 +3,50 @@ package uploads
 
 import (
 	"encoding/json"
+	"errors"
+	"mime/multipart"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"stringmeup/backend/internal/billing"
 	"stringmeup/backend/internal/db"
 	"stringmeup/backend/internal/middleware"
 )
 
 func RegisterRoutes(r chi.Router, svc *Service) {
-	r.Post("/uploads/presign", handlePresign(svc))
+	write := middleware.RequireScopes(middleware.ScopeUploadsWrite)
+	r.With(write).Post("/uploads", handleProxy(svc))
+	r.With(write).Post("/uploads/presign", handlePresign(svc))
+	r.With(write).Put("/uploads/{id}/chunks", handlePutChunk(svc))
+	r.With(write).Get("/uploads/{id}", handleGet(svc))
+	r.With(write).Post("/uploads/{id}/complete", handleComplete(svc))
 }
 
 func handlePresign(svc *Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var body struct {
-			ContentType string `json:"content_type"`
-		}
-		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.ContentType == "" {
-			body.ContentType = "image/jpeg"
+		var body PresignRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			db.Error(w, http.StatusBadRequest, "VALIDATION_ERROR", "invalid body")
+			return
 		}
 
-		result, err := svc.Presign(r.Context(), middleware.UserID(r), body.ContentType)
+		result, err := svc.Presign(r.Context(), middleware.UserID(r), body)
+		var fieldErrs FieldErrors
+		if errors.As(err, &fieldErrs) {
+			db.FieldErrors(w, fieldErrs)
+			return
+		}
+		var quota *QuotaError
+		if errors.As(err, &quota) {
+			db.ErrorWith(w, http.StatusForbidden, "QUOTA_EXCEEDED", quota.Error(),
+				map[string]any{"used_bytes": quota.UsedBytes, "quota_bytes": quota.QuotaBytes})
+			return
+		}
+		if billing.WriteLimitError(w, err) {
+			return
+		}
 		if err != nil {
 			db.Error(w, http.StatusInternalServerError, "SERVER_ERROR", "could not generate upload URL")
 			return
@@ -31,3 +54,141 @@ func handlePresign(svc *Service) http.HandlerFunc {
 		db.Data(w, http.StatusOK, result)
 	}
 }
+
+func handleGet(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, err := svc.GetUpload(r.Context(), chi.URLParam(r, "id"), middleware.UserID(r))
+		if err != nil {
+			db.Error(w, http.StatusNotFound, "NOT_FOUND", err.Error())
+			return
+		}
+		db.Data(w, http.StatusOK, u)
+	}
+}
+
+func handleComplete(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, err := svc.Complete(r.Context(), chi.URLParam(r, "id"), middleware.UserID(r))
+		var rejected *RejectedError
+		switch {
+		case errors.Is(err, ErrUploadNotFound):
+			db.Error(w, http.StatusNotFound, "NOT_FOUND", err.Error())
+		case errors.Is(err, ErrNotUploaded):
+			db.Error(w, http.StatusConflict, "CONFLICT", err.Error())
+		case errors.As(err, &rejected):
+			db.Error(w, http.StatusUnprocessableEntity, "VALIDATION_ERROR", err.Error())
+		case err != nil:
+			db.Error(w, http.StatusInternalServerError, "SERVER_ERROR", err.Error())
+		default:
+			db.Data(w, http.StatusOK, u)
+		}
+	}
+}
+
+// Proxied uploads and chunks can take longer to arrive, and to store,
+// than the server's read and write timeouts allow
+const uploadTimeout = 60 * time.Second
+
+// extendDeadlines gives an upload request uploadTimeout to arrive and be
+// answered. The write deadline must be extended too, or the response to a
+// slow upload is dropped once the server's WriteTimeout passes.
+func extendDeadlines(w http.ResponseWriter) {
+	rc := http.NewResponseController(w)
+	deadline := time.Now().Add(uploadTimeout)
+	rc.SetReadDeadline(deadline)
+	rc.SetWriteDeadline(deadline)
+}
+
+// handleProxy takes the image in the "file" field of a multipart form.
+func handleProxy(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		extendDeadlines(w)
+		r.Body = http.MaxBytesReader(w, r.Body, maxProxyBody())
+		form, err := r.MultipartReader()
+		if err != nil {
+			db.Error(w, http.StatusBadRequest, "VALIDATION_ERROR", "multipart/form-data body required")
+			return
+		}
+		file, err := filePart(form)
+		if err != nil {
+			db.Error(w, http.StatusBadRequest, "VALIDATION_ERROR", "file field required")
+			return
+		}
+		defer file.Close()
+
+		result, err := svc.Proxy(r.Context(), middleware.UserID(r), file)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		db.Data(w, http.StatusCreated, result)
+	}
+}
+
+// filePart skips to the form's "file" field.
+func filePart(form *multipart.Reader) (*multipart.Part, error) {
+	for {
+		part, err := form.NextPart()
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "file" {
+			return part, nil
+		}
+		part.Close()
+	}
+}
+
+// handlePutChunk takes the chunk as the raw request body, with its
+// position in the file in the Upload-Offset header.
+func handlePutChunk(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+		if err != nil || offset < 0 {
+			db.Error(w, http.StatusBadRequest, "VALIDATION_ERROR", "Upload-Offset header required")
+			return
+		}
+		extendDeadlines(w)
+
+		u, err := svc.PutChunk(r.Context(), chi.URLParam(r, "id"), middleware.UserID(r), offset, r.Body)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		db.Data(w, http.StatusOK, u)
+	}
+}
+
+// writeError maps errors from the proxy and chunked upload paths.
+func writeError(w http.ResponseWriter, err error) {
+	var (
+		fieldErrs FieldErrors
+		quota     *QuotaError
+		offset    *OffsetError
+		rejected  *RejectedError
+		tooLarge  *http.MaxBytesError
+	)
+	switch {
+	case errors.As(err, &fieldErrs):
+		db.FieldErrors(w, fieldErrs)
+	case errors.As(err, &quota):
+		db.ErrorWith(w, http.StatusForbidden, "QUOTA_EXCEEDED", quota.Error(),
+			map[string]any{"used_bytes": quota.UsedBytes, "quota_bytes": quota.QuotaBytes})
+	case billing.WriteLimitError(w, err):
+	case errors.As(err, &offset):
+		db.ErrorWith(w, http.StatusConflict, "CONFLICT", offset.Error(),
+			map[string]any{"received_bytes": offset.Received})
+	case errors.As(err, &rejected):
+		db.Error(w, http.StatusUnprocessableEntity, "VALIDATION_ERROR", err.Error())
+	case errors.As(err, &tooLarge):
+		db.Error(w, http.StatusRequestEntityTooLarge, "VALIDATION_ERROR", "request body too large")
+	case errors.Is(err, ErrUploadNotFound):
+		db.Error(w, http.StatusNotFound, "NOT_FOUND", err.Error())
+	case errors.Is(err, ErrNotChunked):
+		db.Error(w, http.StatusConflict, "CONFLICT", err.Error())
+	case errors.Is(err, ErrUploadExpired):
+		db.Error(w, http.StatusGone, "UPLOAD_EXPIRED", err.Error())
+	default:
+		db.Error(w, http.StatusInternalServerError, "SERVER_ERROR", err.Error())
+	}
+}
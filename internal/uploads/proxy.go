@@ -0,0 +1,107 @@
+// internal/uploads/proxy.go
+package uploads
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"stringmeup/backend/internal/billing"
+)
+
+// maxFormOverhead allows for the multipart boundary and part headers around
+// the file in a proxied upload.
+const maxFormOverhead = 64 << 10
+
+// maxProxyBody caps a proxied request before the user's plan is known: the
+// largest upload any plan allows, plus the form around it.
+func maxProxyBody() int64 {
+	var n int64
+	for _, p := range billing.Plans {
+		n = max(n, p.MaxUploadBytes)
+	}
+	return n + maxFormOverhead
+}
+
+// Proxy stores an image sent through the API instead of to a presigned
+// URL, for clients that can't upload to storage directly. The content type
+// is sniffed from the bytes, and the upload is complete by the time Proxy
+// returns, so calling Complete afterwards is optional.
+func (s *Service) Proxy(ctx context.Context, userID string, file io.Reader) (*PresignResult, error) {
+	br := bufio.NewReader(file)
+	head, _ := br.Peek(512)
+	contentType := sniff(head)
+	if !slices.Contains(AllowedContentTypes, contentType) {
+		return nil, FieldErrors{"file": "must be one of " + strings.Join(AllowedContentTypes, ", ")}
+	}
+
+	plan, err := s.billing.PlanFor(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	tmp, size, err := spool(br, plan.MaxUploadBytes+1)
+	if err != nil {
+		return nil, err
+	}
+	defer closeSpool(tmp)
+	if size == 0 {
+		return nil, FieldErrors{"file": "is empty"}
+	}
+	if err := plan.CheckUpload(size); err != nil {
+		return nil, err
+	}
+	// Saves storing a file that can't fit; Complete reserves the space
+	if err := s.checkQuota(ctx, userID, plan, size); err != nil {
+		return nil, err
+	}
+
+	id := uuid.New().String()
+	key := imageKey(userID, id)
+	if err := s.insertUpload(ctx, id, userID, key, contentType, nil); err != nil {
+		return nil, err
+	}
+	if err := s.Put(ctx, key, contentType, tmp, size); err != nil {
+		return nil, err
+	}
+	u, err := s.Complete(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	// u is an earlier upload if this one duplicated it
+	return &PresignResult{
+		ID:       u.ID,
+		Method:   "proxy",
+		Key:      s.publicKey(u.objectKey),
+		MaxBytes: plan.MaxUploadBytes,
+		Upload:   u,
+	}, nil
+}
+
+// spool copies at most limit bytes of r to a temporary file, so the size
+// is known and the body seekable before it goes to storage. The returned
+// file is positioned at the start; release it with closeSpool.
+func spool(r io.Reader, limit int64) (*os.File, int64, error) {
+	tmp, err := os.CreateTemp("", "upload-*")
+	if err != nil {
+		return nil, 0, err
+	}
+	size, err := io.Copy(tmp, io.LimitReader(r, limit))
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		closeSpool(tmp)
+		return nil, 0, fmt.Errorf("spool upload: %w", err)
+	}
+	return tmp, size, nil
+}
+
+func closeSpool(f *os.File) {
+	f.Close()
+	os.Remove(f.Name())
+}
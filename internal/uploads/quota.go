@@ -0,0 +1,219 @@
+// internal/uploads/quota.go
+package uploads
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"stringmeup/backend/internal/billing"
+)
+
+// QuotaError is returned when an upload would take a user past their
+// storage quota.
+type QuotaError struct {
+	UsedBytes  int64
+	QuotaBytes int64
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("storage quota exceeded: %d of %d bytes used", e.UsedBytes, e.QuotaBytes)
+}
+
+// Usage is how much of their quota a user has used. Uploads count once
+// complete, along with their derivatives.
+type Usage struct {
+	UsedBytes  int64  `json:"used_bytes"`
+	QuotaBytes int64  `json:"quota_bytes"` // 0 when unlimited
+	Plan       string `json:"plan"`
+}
+
+// StorageUsed returns the bytes the user is storing. Data exports and
+// avatars don't count; they are ours to clean up.
+func (s *Service) StorageUsed(ctx context.Context, userID string) (int64, error) {
+	var used int64
+	err := s.db.QueryRow(ctx, `SELECT storage_bytes FROM users WHERE id = $1`, userID).Scan(&used)
+	if err != nil {
+		return 0, fmt.Errorf("storage used: %w", err)
+	}
+	return used, nil
+}
+
+func (s *Service) Usage(ctx context.Context, userID string) (*Usage, error) {
+	plan, err := s.billing.PlanFor(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	used, err := s.StorageUsed(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &Usage{UsedBytes: used, QuotaBytes: plan.StorageBytes, Plan: plan.ID}, nil
+}
+
+// checkQuota checks that the user can store adding more bytes. Once the
+// quota is reached nothing more can be uploaded, even an upload of
+// unknown size. It only rejects early; reserveQuota has the final say.
+func (s *Service) checkQuota(ctx context.Context, userID string, plan billing.Plan, adding int64) error {
+	if plan.StorageBytes == 0 {
+		return nil
+	}
+	used, err := s.StorageUsed(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return overQuota(plan, used, adding)
+}
+
+// reserveQuota adds adding bytes to the user's total in tx if they fit in
+// the quota. The user's row stays locked until tx ends, so concurrent
+// completions are counted one after another.
+func reserveQuota(ctx context.Context, tx pgx.Tx, userID string, plan billing.Plan, adding int64) error {
+	var used int64
+	if err := tx.QueryRow(ctx,
+		`SELECT storage_bytes FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&used); err != nil {
+		return fmt.Errorf("storage used: %w", err)
+	}
+	if err := overQuota(plan, used, adding); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx,
+		`UPDATE users SET storage_bytes = storage_bytes + $1 WHERE id = $2`, adding, userID)
+	return err
+}
+
+func overQuota(plan billing.Plan, used, adding int64) error {
+	if plan.StorageBytes == 0 {
+		return nil
+	}
+	if used >= plan.StorageBytes || used+adding > plan.StorageBytes {
+		return &QuotaError{UsedBytes: used, QuotaBytes: plan.StorageBytes}
+	}
+	return nil
+}
+
+// addUsage adjusts the user's cached total. A failure here only causes
+// drift, which Recompute fixes, so callers log rather than fail.
+func (s *Service) addUsage(ctx context.Context, userID string, delta int64) error {
+	if delta == 0 {
+		return nil
+	}
+	_, err := s.db.Exec(ctx,
+		`UPDATE users SET storage_bytes = GREATEST(0, storage_bytes + $1) WHERE id = $2`, delta, userID)
+	return err
+}
+
+// Recomputed reports a user's total before and after Recompute.
+type Recomputed struct {
+	UserID string `json:"user_id"`
+	Before int64  `json:"before"`
+	After  int64  `json:"after"`
+}
+
+// Recompute measures the user's complete uploads and their derivatives in
+// storage, updates the registry to match and resets the cached total. It
+// also recounts the projects using each upload.
+// Objects the registry doesn't know about aren't counted; garbage
+// collection removes them.
+func (s *Service) Recompute(ctx context.Context, userID string) (*Recomputed, error) {
+	sizes := map[string]int64{}
+	derived := map[string]int64{} // by upload ID
+	for _, prefix := range []string{"users/%s/images/", "users/%s/derived/"} {
+		objects, err := s.store.List(ctx, fmt.Sprintf(prefix, userID))
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range objects {
+			sizes[o.Key] = o.Size
+			if rest, ok := strings.CutPrefix(o.Key, fmt.Sprintf("users/%s/derived/", userID)); ok {
+				id, _, _ := strings.Cut(rest, "/")
+				derived[id] += o.Size
+			}
+		}
+	}
+
+	rows, err := s.db.Query(ctx,
+		`SELECT id, object_key FROM uploads WHERE user_id = $1 AND status = 'complete'`, userID)
+	if err != nil {
+		return nil, err
+	}
+	type upload struct{ id, key string }
+	var list []upload
+	for rows.Next() {
+		var u upload
+		if err := rows.Scan(&u.id, &u.key); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		list = append(list, u)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	r := &Recomputed{UserID: userID}
+	if err := tx.QueryRow(ctx,
+		`SELECT storage_bytes FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&r.Before); err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+	for _, u := range list {
+		if _, err := tx.Exec(ctx,
+			`UPDATE uploads SET size_bytes = $1, derived_bytes = $2 WHERE id = $3`,
+			sizes[u.key], derived[u.id], u.id); err != nil {
+			return nil, err
+		}
+		r.After += sizes[u.key] + derived[u.id]
+	}
+	if _, err := tx.Exec(ctx,
+		`UPDATE uploads u SET ref_count = (SELECT COUNT(*) FROM projects p WHERE p.image_upload_id = u.id)
+		 WHERE u.user_id = $1`, userID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx,
+		`UPDATE users SET storage_bytes = $1 WHERE id = $2`, r.After, userID); err != nil {
+		return nil, err
+	}
+	return r, tx.Commit(ctx)
+}
+
+// RecomputeAll recomputes every user's total and returns those that had
+// drifted.
+func (s *Service) RecomputeAll(ctx context.Context) ([]Recomputed, error) {
+	rows, err := s.db.Query(ctx, `SELECT id FROM users ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	drifted := []Recomputed{}
+	for _, id := range ids {
+		r, err := s.Recompute(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("recompute %s: %w", id, err)
+		}
+		if r.Before != r.After {
+			drifted = append(drifted, *r)
+		}
+	}
+	return drifted, nil
+}
@@ -0,0 +1,308 @@
+// internal/uploads/registry.go
+package uploads
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"stringmeup/backend/internal/storage"
+)
+
+var (
+	ErrUploadNotFound = errors.New("upload not found")
+	ErrNotUploaded    = errors.New("object has not been uploaded yet")
+)
+
+// RejectedError explains why Complete refused an object. The object is
+// deleted and the upload can't be completed again.
+type RejectedError struct {
+	Reason string
+}
+
+func (e *RejectedError) Error() string {
+	return "upload rejected: " + e.Reason
+}
+
+type Upload struct {
+	ID          string     `json:"id"`
+	URL         string     `json:"url"`
+	ContentType string     `json:"content_type"`
+	Status      string     `json:"status"`
+	SizeBytes   int64      `json:"size_bytes"`
+	Width       *int       `json:"width"`
+	Height      *int       `json:"height"`
+	SHA256      string     `json:"sha256"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	// Processing tracks the thumbnails and working copies made once the
+	// upload completes; Derivatives links them when it is ready
+	Processing  string       `json:"processing"`
+	Derivatives *Derivatives `json:"derivatives,omitempty"`
+	// Chunked uploads report how much has arrived so clients can resume
+	TotalBytes    *int64 `json:"total_bytes,omitempty"`
+	ReceivedBytes int64  `json:"received_bytes,omitempty"`
+	// RefCount is the number of projects using the upload
+	RefCount int `json:"ref_count"`
+
+	userID      string
+	objectKey   string
+	duplicateOf *string
+}
+
+const uploadColumns = `id, user_id, object_key, content_type, status, size_bytes, width, height,
+	sha256, created_at, completed_at, processing, total_bytes, received_bytes, ref_count, duplicate_of`
+
+func (s *Service) scanUpload(row pgx.Row) (*Upload, error) {
+	u := &Upload{}
+	err := row.Scan(&u.ID, &u.userID, &u.objectKey, &u.ContentType, &u.Status, &u.SizeBytes,
+		&u.Width, &u.Height, &u.SHA256, &u.CreatedAt, &u.CompletedAt, &u.Processing,
+		&u.TotalBytes, &u.ReceivedBytes, &u.RefCount, &u.duplicateOf)
+	if err != nil {
+		return nil, err
+	}
+	u.URL = s.URL(u.objectKey)
+	if u.Processing == ProcessingReady {
+		u.Derivatives = s.Derivatives(u.userID, u.ID)
+	}
+	return u, nil
+}
+
+// Key returns the upload's object key, which is what other services store.
+func (u *Upload) Key() string {
+	return u.objectKey
+}
+
+// GetUpload returns one of the user's uploads in any status. A duplicate
+// resolves to the upload it duplicates, which holds the content.
+func (s *Service) GetUpload(ctx context.Context, id, userID string) (*Upload, error) {
+	u, err := s.scanUpload(s.db.QueryRow(ctx,
+		`SELECT `+uploadColumns+` FROM uploads WHERE id = $1 AND user_id = $2`, id, userID))
+	if err != nil {
+		return nil, ErrUploadNotFound
+	}
+	if u.Status == "duplicate" && u.duplicateOf != nil {
+		return s.GetUpload(ctx, *u.duplicateOf, userID)
+	}
+	return u, nil
+}
+
+// Owned returns the upload if it is complete and belongs to userID. It is
+// how other services check an upload ID a client gave them.
+func (s *Service) Owned(ctx context.Context, id, userID string) (*Upload, error) {
+	u, err := s.GetUpload(ctx, id, userID)
+	if err != nil || u.Status != "complete" {
+		return nil, ErrUploadNotFound
+	}
+	return u, nil
+}
+
+// Retain and Release count a project starting and stopping using an
+// upload. They run in tx, the transaction that changes the project, so the
+// count commits or rolls back with it.
+func (s *Service) Retain(ctx context.Context, tx pgx.Tx, id string) error {
+	return addRefs(ctx, tx, id, 1)
+}
+
+func (s *Service) Release(ctx context.Context, tx pgx.Tx, id string) error {
+	return addRefs(ctx, tx, id, -1)
+}
+
+func addRefs(ctx context.Context, tx pgx.Tx, id string, delta int) error {
+	_, err := tx.Exec(ctx,
+		`UPDATE uploads SET ref_count = GREATEST(0, ref_count + $1) WHERE id = $2`, delta, id)
+	if err != nil {
+		return fmt.Errorf("count references to %s: %w", id, err)
+	}
+	return nil
+}
+
+// Complete verifies an object the client uploaded to a presigned URL and
+// records its size, dimensions and hash. Calling it again on a complete
+// upload returns the recorded upload. If the user already has an upload
+// with the same content, the new object is deleted and that upload is
+// returned instead, so clients must use the returned ID.
+func (s *Service) Complete(ctx context.Context, id, userID string) (*Upload, error) {
+	u, err := s.GetUpload(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Status {
+	case "complete":
+		return u, nil
+	case "rejected":
+		return nil, ErrUploadNotFound
+	}
+
+	head, err := s.store.Head(ctx, u.objectKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrNotUploaded
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The presigned request already limits the size; this catches objects
+	// from providers that don't enforce it, and plans that have shrunk
+	plan, err := s.billing.PlanFor(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	size := head.Size
+	if size == 0 || plan.CheckUpload(size) != nil {
+		return nil, s.reject(ctx, u, fmt.Sprintf("size must be between 1 byte and %d MB", plan.MaxUploadBytes>>20))
+	}
+	if ct := head.ContentType; ct != u.ContentType {
+		return nil, s.reject(ctx, u, fmt.Sprintf("stored as %s, expected %s", ct, u.ContentType))
+	}
+
+	body, err := s.Get(ctx, u.objectKey)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	info, err := inspect(body, u.ContentType)
+	if err != nil {
+		return nil, err
+	}
+	if info.reason != "" {
+		return nil, s.reject(ctx, u, info.reason)
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	// Completions of the same content by the same user take turns, so two
+	// copies can't both become the original
+	if _, err := tx.Exec(ctx,
+		`SELECT pg_advisory_xact_lock(hashtextextended($1, 0))`, userID+":"+info.sha256); err != nil {
+		return nil, err
+	}
+	var originalID string
+	err = tx.QueryRow(ctx,
+		`SELECT id FROM uploads
+		 WHERE user_id = $1 AND sha256 = $2 AND status = 'complete' AND id <> $3
+		 ORDER BY completed_at LIMIT 1 FOR SHARE`, userID, info.sha256, id).Scan(&originalID)
+	if err == nil {
+		return s.completeDuplicate(ctx, tx, u, originalID, size, info)
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	// Only content new to the user counts towards the quota
+	if err := reserveQuota(ctx, tx, userID, plan, size); err != nil {
+		var quota *QuotaError
+		if !errors.As(err, &quota) {
+			return nil, err
+		}
+		tx.Rollback(ctx)
+		return nil, s.reject(ctx, u, quota.Error())
+	}
+	u, err = s.scanUpload(tx.QueryRow(ctx,
+		`UPDATE uploads
+		 SET status = 'complete', size_bytes = $1, width = $2, height = $3, sha256 = $4,
+		     completed_at = NOW()
+		 WHERE id = $5 AND status = 'pending'
+		 RETURNING `+uploadColumns,
+		size, info.width, info.height, info.sha256, id))
+	if err != nil {
+		// Completed concurrently by another request
+		tx.Rollback(ctx)
+		return s.Owned(ctx, id, userID)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return u, nil
+}
+
+// completeDuplicate records u as a copy of the user's upload originalID,
+// deletes its object and returns the original. Nothing new is stored, so
+// the user's usage doesn't change; the original's derivatives serve both.
+func (s *Service) completeDuplicate(ctx context.Context, tx pgx.Tx, u *Upload, originalID string, size int64, info *objectInfo) (*Upload, error) {
+	tag, err := tx.Exec(ctx,
+		`UPDATE uploads
+		 SET status = 'duplicate', duplicate_of = $1, size_bytes = $2, width = $3, height = $4,
+		     sha256 = $5, completed_at = NOW()
+		 WHERE id = $6 AND status = 'pending'`,
+		originalID, size, info.width, info.height, info.sha256, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() > 0 {
+		if err := s.Delete(ctx, u.objectKey); err != nil {
+			// Unreferenced, so the collector removes it later
+			log.Printf("uploads: delete duplicate %s: %v", u.ID, err)
+		}
+	}
+	return s.Owned(ctx, originalID, u.userID)
+}
+
+type objectInfo struct {
+	width, height *int
+	sha256        string
+	reason        string // why the object was rejected, if it was
+}
+
+// heicBrands are the ISO BMFF major brands used by HEIF/HEIC images.
+var heicBrands = []string{"heic", "heix", "hevc", "hevx", "heim", "heis", "mif1", "msf1"}
+
+// sniff detects the content type of an object from its first bytes. Go's
+// detector covers everything allowed except HEIC.
+func sniff(head []byte) string {
+	if len(head) >= 12 && string(head[4:8]) == "ftyp" && slices.Contains(heicBrands, string(head[8:12])) {
+		return "image/heic"
+	}
+	return http.DetectContentType(head)
+}
+
+// inspect hashes the object, checks its bytes look like contentType and
+// reads its dimensions when a decoder is available.
+func inspect(r io.Reader, contentType string) (*objectInfo, error) {
+	h := sha256.New()
+	br := bufio.NewReader(io.TeeReader(r, h))
+
+	info := &objectInfo{}
+	head, _ := br.Peek(512)
+	if got := sniff(head); got != contentType {
+		info.reason = fmt.Sprintf("content looks like %s, not %s", got, contentType)
+		return info, nil
+	}
+	if cfg, _, err := image.DecodeConfig(br); err == nil {
+		info.width, info.height = &cfg.Width, &cfg.Height
+	}
+	if _, err := io.Copy(io.Discard, br); err != nil {
+		return nil, fmt.Errorf("read object: %w", err)
+	}
+	info.sha256 = hex.EncodeToString(h.Sum(nil))
+	return info, nil
+}
+
+func (s *Service) reject(ctx context.Context, u *Upload, reason string) error {
+	if err := s.Delete(ctx, u.objectKey); err != nil {
+		return err
+	}
+	s.db.Exec(ctx, `UPDATE uploads SET status = 'rejected' WHERE id = $1`, u.ID)
+	return &RejectedError{Reason: reason}
+}
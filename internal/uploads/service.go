@@ -4,68 +4,214 @@ package uploads
 import (
 	"context"
 	"fmt"
+	"io"
+	"slices"
+	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/credentials"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	smithyendpoints "github.com/aws/smithy-go/endpoints"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"stringmeup/backend/internal/billing"
 	"stringmeup/backend/internal/config"
+	"stringmeup/backend/internal/storage"
 )
 
-// r2EndpointResolver routes all S3 calls to Cloudflare R2
-type r2EndpointResolver struct {
-	accountID string
+const presignTTL = 15 * time.Minute
+
+// AllowedContentTypes are the image types clients may upload.
+var AllowedContentTypes = []string{"image/jpeg", "image/png", "image/heic", "image/webp"}
+
+var extensions = map[string]string{
+	"image/jpeg": ".jpg", "image/png": ".png", "image/heic": ".heic", "image/webp": ".webp",
 }
 
-func (r *r2EndpointResolver) ResolveEndpoint(ctx context.Context, params s3.EndpointParameters) (
-	smithyendpoints.Endpoint, error) {
-	return smithyendpoints.Endpoint{
-		URI: *aws.String(fmt.Sprintf("https://%s.r2.cloudflarestorage.com", r.accountID)),
-	}, nil
+// Extension returns the file extension for an allowed content type, or ""
+// for any other.
+func Extension(contentType string) string {
+	return extensions[contentType]
 }
 
 type Service struct {
-	presigner *s3.PresignClient
-	bucket    string
-	publicURL string
+	db      *pgxpool.Pool
+	cfg     *config.Config
+	store   storage.Storage
+	billing *billing.Service
+	wake    chan struct{}
+	urls    *urlCache
+}
+
+func NewService(db *pgxpool.Pool, cfg *config.Config, store storage.Storage, billing *billing.Service) *Service {
+	return &Service{db: db, cfg: cfg, store: store, billing: billing,
+		wake: make(chan struct{}, 1), urls: newURLCache()}
 }
 
-func NewService(cfg *config.Config) *Service {
-	client := s3.New(s3.Options{
-		Region: "auto",
-		Credentials: credentials.NewStaticCredentialsProvider(
-			cfg.R2AccessKeyID, cfg.R2SecretAccessKey, ""),
-		EndpointResolverV2: &r2EndpointResolver{accountID: cfg.R2AccountID},
-	})
+// FieldErrors is returned by Presign when the request fails validation.
+type FieldErrors map[string]string
 
-	return &Service{
-		presigner: s3.NewPresignClient(client),
-		bucket:    cfg.R2BucketName,
-		publicURL: cfg.R2PublicURL,
-	}
+func (e FieldErrors) Error() string {
+	return fmt.Sprintf("%d invalid fields", len(e))
+}
+
+type PresignRequest struct {
+	ContentType string `json:"content_type"`
+	// Method is "put" (the default), "post" or "chunked". A PUT's
+	// signature covers the exact Size; chunked uploads go through the API
+	// and also need Size. Only storage backends with POST policies accept
+	// "post", which signs a size range instead.
+	Method string `json:"method"`
+	Size   int64  `json:"size"`
 }
 
+// PresignResult says how to upload the object. For PUT, send the file with
+// Headers; for POST, send a multipart form with Fields followed by the file
+// in a field named "file"; for chunked, PUT it to URL in chunks of at most
+// ChunkBytes. Once uploaded, the client calls Complete with ID. Key is the
+// object's eventual public URL, or its storage key when the bucket is
+// private. Proxied uploads have no URL or expiry, and carry the completed
+// Upload instead.
 type PresignResult struct {
-	URL string `json:"url"`
-	Key string `json:"key"`
+	ID         string            `json:"id"`
+	Method     string            `json:"method"`
+	URL        string            `json:"url,omitempty"`
+	Fields     map[string]string `json:"fields,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Key        string            `json:"key"`
+	MaxBytes   int64             `json:"max_bytes"`
+	ChunkBytes int64             `json:"chunk_bytes,omitempty"`
+	ExpiresAt  *time.Time        `json:"expires_at,omitempty"`
+	Upload     *Upload           `json:"upload,omitempty"`
 }
 
-func (s *Service) Presign(ctx context.Context, userID, contentType string) (*PresignResult, error) {
-	key := fmt.Sprintf("users/%s/images/%s", userID, uuid.New().String())
+func (s *Service) Presign(ctx context.Context, userID string, req PresignRequest) (*PresignResult, error) {
+	errs := FieldErrors{}
+	if !slices.Contains(AllowedContentTypes, req.ContentType) {
+		errs["content_type"] = "must be one of " + strings.Join(AllowedContentTypes, ", ")
+	}
+	if req.Method == "" {
+		req.Method = "put"
+	}
+	poster, canPost := s.store.(storage.PostPresigner)
+	switch req.Method {
+	case "post":
+		if !canPost {
+			errs["method"] = "post isn't supported by this storage backend, use put or chunked"
+		} else if req.Size < 0 {
+			errs["size"] = "must be positive"
+		}
+	case "put", "chunked":
+		if req.Size <= 0 {
+			errs["size"] = "is required for " + req.Method + " uploads"
+		}
+	default:
+		errs["method"] = "must be put, post or chunked"
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
 
-	req, err := s.presigner.PresignPutObject(ctx, &s3.PutObjectInput{
-		Bucket:      aws.String(s.bucket),
-		Key:         aws.String(key),
-		ContentType: aws.String(contentType),
-	}, s3.WithPresignExpires(15*time.Minute))
+	plan, err := s.billing.PlanFor(ctx, userID)
 	if err != nil {
-		return nil, fmt.Errorf("presign: %w", err)
+		return nil, err
+	}
+	if err := plan.CheckUpload(req.Size); err != nil {
+		return nil, err
 	}
+	if err := s.checkQuota(ctx, userID, plan, req.Size); err != nil {
+		return nil, err
+	}
+
+	id := uuid.New().String()
+	key := imageKey(userID, id)
+	if req.Method == "chunked" {
+		return s.startChunked(ctx, id, userID, key, req, plan.MaxUploadBytes)
+	}
+	expires := time.Now().UTC().Add(presignTTL)
+	res := &PresignResult{
+		ID:        id,
+		Method:    req.Method,
+		Key:       s.publicKey(key),
+		MaxBytes:  plan.MaxUploadBytes,
+		ExpiresAt: &expires,
+	}
+
+	var signed *storage.Request
+	if req.Method == "post" {
+		signed, err = poster.PresignPost(ctx, key, req.ContentType, plan.MaxUploadBytes, presignTTL)
+	} else {
+		signed, err = s.store.PresignPut(ctx, key, req.ContentType, req.Size, presignTTL)
+	}
+	if err != nil {
+		return nil, err
+	}
+	res.URL, res.Fields, res.Headers = signed.URL, signed.Fields, signed.Headers
+
+	if err := s.insertUpload(ctx, id, userID, key, req.ContentType, nil); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
 
-	return &PresignResult{
-		URL: req.URL,
-		Key: fmt.Sprintf("%s/%s", s.publicURL, key),
-	}, nil
+// imageKey is where an upload's original image is stored.
+func imageKey(userID, uploadID string) string {
+	return fmt.Sprintf("users/%s/images/%s", userID, uploadID)
+}
+
+// insertUpload records a pending upload. totalBytes is set for chunked
+// uploads only.
+func (s *Service) insertUpload(ctx context.Context, id, userID, key, contentType string, totalBytes *int64) error {
+	_, err := s.db.Exec(ctx,
+		`INSERT INTO uploads (id, user_id, object_key, content_type, total_bytes)
+		 VALUES ($1, $2, $3, $4, $5)`,
+		id, userID, key, contentType, totalBytes)
+	if err != nil {
+		return fmt.Errorf("insert upload: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the objects at keys.
+func (s *Service) Delete(ctx context.Context, keys ...string) error {
+	return s.store.Delete(ctx, keys...)
+}
+
+// DeletePrefix removes every object under prefix.
+func (s *Service) DeletePrefix(ctx context.Context, prefix string) error {
+	objects, err := s.store.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, len(objects))
+	for i, o := range objects {
+		keys[i] = o.Key
+	}
+	return s.Delete(ctx, keys...)
+}
+
+// Put uploads body to key. size must be the exact length of body.
+func (s *Service) Put(ctx context.Context, key, contentType string, body io.Reader, size int64) error {
+	return s.store.Put(ctx, key, contentType, body, size)
+}
+
+// Get opens the object at key. The caller must close the returned body.
+func (s *Service) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.store.Get(ctx, key)
+}
+
+// PresignGet returns a URL that downloads key until ttl passes.
+func (s *Service) PresignGet(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	return s.store.PresignGet(ctx, key, ttl)
+}
+
+// KeyFromURL recovers the object key from a public URL.
+func (s *Service) KeyFromURL(u string) (string, bool) {
+	return strings.CutPrefix(u, s.store.PublicURL(""))
+}
+
+// publicKey is what PresignResult.Key reports: the object's public URL, or
+// just its key when the bucket is private.
+func (s *Service) publicKey(key string) string {
+	if s.cfg.StoragePrivate {
+		return key
+	}
+	return s.store.PublicURL(key)
 }
@@ -0,0 +1,108 @@
+// internal/uploads/urls.go
+package uploads
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// signedURLTTL is how long presigned GET URLs handed to clients last
+	signedURLTTL = time.Hour
+	// A cached URL is reused until it has less than this left, so clients
+	// always get at least this long to use it
+	signedURLMinLeft = 15 * time.Minute
+)
+
+// urlCache holds presigned GET URLs by key, so listing projects doesn't
+// sign every image again on every request.
+type urlCache struct {
+	mu      sync.Mutex
+	entries map[string]signedURL
+	swept   time.Time
+}
+
+type signedURL struct {
+	url     string
+	expires time.Time
+}
+
+func newURLCache() *urlCache {
+	return &urlCache{entries: map[string]signedURL{}}
+}
+
+func (c *urlCache) get(key string, now time.Time) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || e.expires.Sub(now) < signedURLMinLeft {
+		return "", false
+	}
+	return e.url, true
+}
+
+func (c *urlCache) put(key, url string, expires, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = signedURL{url: url, expires: expires}
+	// Drop stale entries now and then so the cache doesn't grow forever
+	if now.Sub(c.swept) > signedURLTTL {
+		for k, e := range c.entries {
+			if e.expires.Sub(now) < signedURLMinLeft {
+				delete(c.entries, k)
+			}
+		}
+		c.swept = now
+	}
+}
+
+// URL returns the URL clients should use to fetch key: its public URL, or
+// with a private bucket a presigned GET from the cache.
+func (s *Service) URL(key string) string {
+	if !s.cfg.StoragePrivate {
+		return s.store.PublicURL(key)
+	}
+	now := time.Now()
+	if u, ok := s.urls.get(key, now); ok {
+		return u
+	}
+	// Presigning is local computation, so it needs no request context
+	u, err := s.store.PresignGet(context.Background(), key, signedURLTTL)
+	if err != nil {
+		log.Printf("uploads: sign %s: %v", key, err)
+		return ""
+	}
+	s.urls.put(key, u, now.Add(signedURLTTL), now)
+	return u
+}
+
+// StoredKey returns the object key in a stored image reference of a row
+// owned by ownerID. Older rows hold the full public URL; newer ones hold
+// only the key. ok is false for URLs outside our bucket, and for keys
+// outside the owner's folder, which legacy rows could point anywhere.
+func (s *Service) StoredKey(ownerID, ref string) (string, bool) {
+	key, ok := s.KeyFromURL(ref)
+	if !ok {
+		if ref == "" || strings.Contains(ref, "://") {
+			return "", false
+		}
+		key = ref
+	}
+	if ownerID == "" || !strings.HasPrefix(key, "users/"+ownerID+"/") {
+		return "", false
+	}
+	return key, true
+}
+
+// ResolveURL turns a stored image reference of a row owned by ownerID into
+// a URL for clients. References StoredKey refuses are passed through
+// unsigned.
+func (s *Service) ResolveURL(ownerID, ref string) string {
+	if key, ok := s.StoredKey(ownerID, ref); ok {
+		return s.URL(key)
+	}
+	return ref
+}
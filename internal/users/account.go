@@ -0,0 +1,167 @@
+// internal/users/account.go
+package users
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"golang.org/x/crypto/bcrypt"
+	"stringmeup/backend/internal/i18n"
+	"stringmeup/backend/internal/mail"
+	"stringmeup/backend/internal/notifications"
+)
+
+const emailChangeTTL = 24 * time.Hour
+
+var (
+	ErrEmailTaken        = errors.New("email is already in use")
+	ErrInvalidEmailToken = errors.New("invalid or expired confirmation link")
+)
+
+// ChangePassword replaces the password after checking the current one. It
+// signs out every session but keepSession, the caller's own, and revokes
+// every personal access token. With no keepSession, every session ends.
+func (s *Service) ChangePassword(ctx context.Context, id, current, next, keepSession string) error {
+	if err := s.checkPassword(ctx, id, current); err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(next), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var keep *string
+	if keepSession != "" {
+		keep = &keepSession
+	}
+	if _, err := tx.Exec(ctx,
+		`UPDATE users SET password_hash = $1, sessions_revoked_at = NOW(), sessions_kept_id = $2
+		 WHERE id = $3`, string(hash), keep, id); err != nil {
+		return fmt.Errorf("update password: %w", err)
+	}
+	if _, err := tx.Exec(ctx,
+		`DELETE FROM refresh_tokens
+		 WHERE user_id = $1 AND session_id IS DISTINCT FROM $2`, id, keep); err != nil {
+		return fmt.Errorf("revoke sessions: %w", err)
+	}
+	if _, err := tx.Exec(ctx,
+		`UPDATE personal_access_tokens SET revoked_at = NOW()
+		 WHERE user_id = $1 AND revoked_at IS NULL`, id); err != nil {
+		return fmt.Errorf("revoke access tokens: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	s.notify.Notify(ctx, id, notifications.KindSecurity, "notification.password_changed", nil, nil)
+	return nil
+}
+
+// RequestEmailChange emails a confirmation link to newEmail. The address
+// is only switched when ConfirmEmailChange is called with that link.
+func (s *Service) RequestEmailChange(ctx context.Context, id, password, newEmail string) error {
+	if err := s.checkPassword(ctx, id, password); err != nil {
+		return err
+	}
+	newEmail = strings.TrimSpace(newEmail)
+
+	var taken bool
+	err := s.db.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM users WHERE email = $1)`, newEmail).Scan(&taken)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrEmailTaken
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	// Only the latest request for a user stays valid
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, `DELETE FROM email_changes WHERE user_id = $1`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx,
+		`INSERT INTO email_changes (token_hash, user_id, new_email, expires_at)
+		 VALUES ($1, $2, $3, $4)`,
+		hashToken(token), id, newEmail, time.Now().UTC().Add(emailChangeTTL)); err != nil {
+		return fmt.Errorf("insert email change: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/account/confirm-email?token=%s", s.cfg.AppURL, url.QueryEscape(token))
+	loc := i18n.Resolve(ctx, s.Locale(ctx, id))
+	return s.mailer.Send(ctx, mail.Message{
+		To:      newEmail,
+		Subject: i18n.T(loc, "email.email_change.subject"),
+		Text:    i18n.T(loc, "email.email_change.body", link),
+	})
+}
+
+// ConfirmEmailChange applies the change the token was issued for. The
+// previous address is told about the change.
+func (s *Service) ConfirmEmailChange(ctx context.Context, token string) (*User, error) {
+	var id, newEmail, oldEmail string
+	err := s.db.QueryRow(ctx,
+		`DELETE FROM email_changes c USING users u
+		 WHERE c.token_hash = $1 AND c.expires_at > NOW() AND u.id = c.user_id
+		 RETURNING c.user_id, c.new_email, u.email`, hashToken(token),
+	).Scan(&id, &newEmail, &oldEmail)
+	if err != nil {
+		return nil, ErrInvalidEmailToken
+	}
+
+	// Another account may have claimed the address since the request
+	_, err = s.db.Exec(ctx, `UPDATE users SET email = $1 WHERE id = $2`, newEmail, id)
+	if isUniqueViolation(err) {
+		return nil, ErrEmailTaken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("update email: %w", err)
+	}
+
+	loc := i18n.Resolve(ctx, s.Locale(ctx, id))
+	s.mailer.Send(ctx, mail.Message{
+		To:      oldEmail,
+		Subject: i18n.T(loc, "email.email_changed.subject"),
+		Text:    i18n.T(loc, "email.email_changed.body", newEmail),
+	})
+	s.notify.Notify(ctx, id, notifications.KindSecurity, "notification.email_changed",
+		[]any{newEmail}, nil)
+	return s.GetByID(ctx, id)
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,176 @@
+// internal/users/deletion.go
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrWrongPassword = errors.New("password is incorrect")
+
+// ScheduleDeletion checks the user's password and schedules the account for
+// deletion after the configured grace period. All sessions, including
+// access JWTs already issued, and personal access tokens are revoked;
+// logging in again before the deadline cancels it.
+func (s *Service) ScheduleDeletion(ctx context.Context, id, password string) (time.Time, error) {
+	if err := s.checkPassword(ctx, id, password); err != nil {
+		return time.Time{}, err
+	}
+
+	at := time.Now().UTC().Add(s.cfg.AccountDeletionGrace)
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx,
+		`UPDATE users SET deletion_scheduled_at = $1, sessions_revoked_at = NOW(), sessions_kept_id = NULL
+		 WHERE id = $2`, at, id); err != nil {
+		return time.Time{}, fmt.Errorf("schedule deletion: %w", err)
+	}
+	if _, err := tx.Exec(ctx,
+		`DELETE FROM refresh_tokens WHERE user_id = $1`, id); err != nil {
+		return time.Time{}, fmt.Errorf("revoke sessions: %w", err)
+	}
+	if _, err := tx.Exec(ctx,
+		`UPDATE personal_access_tokens SET revoked_at = NOW()
+		 WHERE user_id = $1 AND revoked_at IS NULL`, id); err != nil {
+		return time.Time{}, fmt.Errorf("revoke access tokens: %w", err)
+	}
+	return at, tx.Commit(ctx)
+}
+
+// RunDeletions purges accounts whose grace period has passed, hourly, until
+// ctx is cancelled.
+func (s *Service) RunDeletions(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.purgeDeleted(ctx); err != nil {
+				log.Printf("users: purge deleted: %v", err)
+			}
+			if err := s.purgeStorage(ctx); err != nil {
+				log.Printf("users: purge storage: %v", err)
+			}
+		}
+	}
+}
+
+func (s *Service) purgeDeleted(ctx context.Context) error {
+	rows, err := s.db.Query(ctx,
+		`SELECT id FROM users
+		 WHERE deletion_scheduled_at <= NOW()
+		 ORDER BY deletion_scheduled_at LIMIT 100`)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		deleted, err := s.deleteUser(ctx, id)
+		if err != nil {
+			return fmt.Errorf("delete user %s: %w", id, err)
+		}
+		if deleted {
+			log.Printf("users: deleted account %s", id)
+		}
+	}
+	return nil
+}
+
+// deleteUser deletes the account's rows and queues its stored objects for
+// purgeStorage. Rows go first so a storage failure can't leave a
+// half-deleted account that the user could still log in to.
+func (s *Service) deleteUser(ctx context.Context, id string) (bool, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+	// Re-check the deadline in the DELETE in case the user logged in
+	// since the SELECT. Every other table cascades from users.
+	tag, err := tx.Exec(ctx,
+		`DELETE FROM users WHERE id = $1 AND deletion_scheduled_at <= NOW()`, id)
+	if err != nil || tag.RowsAffected() == 0 {
+		return false, err
+	}
+	if _, err := tx.Exec(ctx,
+		`INSERT INTO storage_purges (user_id) VALUES ($1) ON CONFLICT DO NOTHING`, id); err != nil {
+		return false, err
+	}
+	return true, tx.Commit(ctx)
+}
+
+// purgeStorage removes everything deleted accounts had stored: images,
+// derivatives, avatars and exports. Purges that fail stay queued and are
+// retried on the next run.
+func (s *Service) purgeStorage(ctx context.Context) error {
+	rows, err := s.db.Query(ctx,
+		`SELECT user_id FROM storage_purges ORDER BY created_at LIMIT 100`)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := s.uploads.DeletePrefix(ctx, fmt.Sprintf("users/%s/", id)); err != nil {
+			log.Printf("users: delete storage for %s: %v", id, err)
+			if _, err := s.db.Exec(ctx,
+				`UPDATE storage_purges SET attempts = attempts + 1 WHERE user_id = $1`, id); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := s.db.Exec(ctx, `DELETE FROM storage_purges WHERE user_id = $1`, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Service) checkPassword(ctx context.Context, id, password string) error {
+	var hash string
+	err := s.db.QueryRow(ctx,
+		`SELECT password_hash FROM users WHERE id = $1`, id).Scan(&hash)
+	if err != nil {
+		return fmt.Errorf("user not found")
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return ErrWrongPassword
+	}
+	return nil
+}
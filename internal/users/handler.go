@@ -3,6 +3,7 @@ package users
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
@@ -11,13 +12,24 @@ import (
 )
 
 func RegisterRoutes(r chi.Router, svc *Service) {
-	r.Get("/users/me", handleGetMe(svc))
-	r.Patch("/users/me", handleUpdateMe(svc))
+	r.With(middleware.RequireScopes(middleware.ScopeProfileRead)).Get("/users/me", handleGetMe(svc))
+	r.With(middleware.RequireScopes(middleware.ScopeProfileWrite)).Patch("/users/me", handleUpdateMe(svc))
+	r.With(middleware.RequireScopes(middleware.ScopeProfileWrite)).Put("/users/me/avatar", handleSetAvatar(svc))
+	r.With(middleware.RequireScopes(middleware.ScopeProfileWrite)).Delete("/users/me/avatar", handleDeleteAvatar(svc))
+	r.With(middleware.RequireSession).Delete("/users/me", handleDeleteMe(svc))
+	r.With(middleware.RequireSession).Post("/users/me/password", handleChangePassword(svc))
+	r.With(middleware.RequireSession).Post("/users/me/email", handleChangeEmail(svc))
+}
+
+// RegisterPublicRoutes registers routes reached from email links, where the
+// user may not be logged in on that device.
+func RegisterPublicRoutes(r chi.Router, svc *Service) {
+	r.Post("/users/email/confirm", handleConfirmEmail(svc))
 }
 
 func handleGetMe(svc *Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		user, err := svc.GetByID(r.Context(), middleware.UserID(r))
+		user, err := svc.GetMe(r.Context(), middleware.UserID(r))
 		if err != nil {
 			db.Error(w, http.StatusNotFound, "NOT_FOUND", "user not found")
 			return
@@ -34,10 +46,150 @@ func handleUpdateMe(svc *Service) http.HandlerFunc {
 			return
 		}
 		user, err := svc.Update(r.Context(), middleware.UserID(r), body)
+		var fieldErrs FieldErrors
+		if errors.As(err, &fieldErrs) {
+			db.FieldErrors(w, fieldErrs)
+			return
+		}
+		if err != nil {
+			db.Error(w, http.StatusInternalServerError, "SERVER_ERROR", err.Error())
+			return
+		}
+		db.Data(w, http.StatusOK, user)
+	}
+}
+
+// handleSetAvatar takes the image as the raw request body.
+func handleSetAvatar(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body := http.MaxBytesReader(w, r.Body, MaxAvatarBytes)
+		user, err := svc.SetAvatar(r.Context(), middleware.UserID(r), body)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			db.Error(w, http.StatusRequestEntityTooLarge, "VALIDATION_ERROR", "avatar must be at most 5 MB")
+			return
+		}
+		if errors.Is(err, ErrInvalidImage) {
+			db.Error(w, http.StatusUnprocessableEntity, "VALIDATION_ERROR", err.Error())
+			return
+		}
+		if err != nil {
+			db.Error(w, http.StatusInternalServerError, "SERVER_ERROR", err.Error())
+			return
+		}
+		db.Data(w, http.StatusOK, user)
+	}
+}
+
+func handleDeleteAvatar(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := svc.DeleteAvatar(r.Context(), middleware.UserID(r)); err != nil {
+			db.Error(w, http.StatusInternalServerError, "SERVER_ERROR", err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func handleDeleteMe(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Password == "" {
+			db.Error(w, http.StatusBadRequest, "VALIDATION_ERROR", "password required")
+			return
+		}
+
+		at, err := svc.ScheduleDeletion(r.Context(), middleware.UserID(r), body.Password)
+		if errors.Is(err, ErrWrongPassword) {
+			db.Error(w, http.StatusUnauthorized, "UNAUTHORIZED", err.Error())
+			return
+		}
 		if err != nil {
 			db.Error(w, http.StatusInternalServerError, "SERVER_ERROR", err.Error())
 			return
 		}
+		db.Data(w, http.StatusAccepted, map[string]any{"deletion_scheduled_at": at})
+	}
+}
+
+func handleChangePassword(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			CurrentPassword string `json:"current_password"`
+			NewPassword     string `json:"new_password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil ||
+			body.CurrentPassword == "" || body.NewPassword == "" {
+			db.Error(w, http.StatusBadRequest, "VALIDATION_ERROR", "current_password and new_password required")
+			return
+		}
+
+		err := svc.ChangePassword(r.Context(), middleware.UserID(r),
+			body.CurrentPassword, body.NewPassword, middleware.SessionID(r))
+		if errors.Is(err, ErrWrongPassword) {
+			db.Error(w, http.StatusUnauthorized, "UNAUTHORIZED", err.Error())
+			return
+		}
+		if err != nil {
+			db.Error(w, http.StatusInternalServerError, "SERVER_ERROR", err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func handleChangeEmail(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Password string `json:"password"`
+			NewEmail string `json:"new_email"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil ||
+			body.Password == "" || body.NewEmail == "" {
+			db.Error(w, http.StatusBadRequest, "VALIDATION_ERROR", "password and new_email required")
+			return
+		}
+
+		err := svc.RequestEmailChange(r.Context(), middleware.UserID(r), body.Password, body.NewEmail)
+		switch {
+		case errors.Is(err, ErrWrongPassword):
+			db.Error(w, http.StatusUnauthorized, "UNAUTHORIZED", err.Error())
+			return
+		case errors.Is(err, ErrEmailTaken):
+			db.Error(w, http.StatusConflict, "EMAIL_TAKEN", err.Error())
+			return
+		case err != nil:
+			db.Error(w, http.StatusInternalServerError, "SERVER_ERROR", err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func handleConfirmEmail(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Token == "" {
+			db.Error(w, http.StatusBadRequest, "VALIDATION_ERROR", "token required")
+			return
+		}
+
+		user, err := svc.ConfirmEmailChange(r.Context(), body.Token)
+		switch {
+		case errors.Is(err, ErrEmailTaken):
+			db.Error(w, http.StatusConflict, "EMAIL_TAKEN", err.Error())
+			return
+		case errors.Is(err, ErrInvalidEmailToken):
+			db.Error(w, http.StatusBadRequest, "VALIDATION_ERROR", err.Error())
+			return
+		case err != nil:
+			db.Error(w, http.StatusInternalServerError, "SERVER_ERROR", err.Error())
+			return
+		}
 		db.Data(w, http.StatusOK, user)
 	}
 }
@@ -0,0 +1,191 @@
+// internal/users/preferences.go
+package users
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"stringmeup/backend/internal/i18n"
+	"stringmeup/backend/internal/units"
+)
+
+// Preferences is a user's full preference set: every key in prefSchema,
+// with stored values laid over the defaults.
+type Preferences map[string]any
+
+func (p Preferences) String(key string) string {
+	v, _ := p[key].(string)
+	return v
+}
+
+func (p Preferences) Float(key string) float64 {
+	v, _ := p[key].(float64)
+	return v
+}
+
+func (p Preferences) Bool(key string) bool {
+	v, _ := p[key].(bool)
+	return v
+}
+
+type prefKind int
+
+const (
+	prefString prefKind = iota
+	prefNumber
+	prefBool
+)
+
+// prefField describes one preference. To add a preference, append it to
+// prefSchema; no migration is needed since only values a user has set are
+// stored, and everyone else gets def.
+type prefField struct {
+	key      string
+	kind     prefKind
+	def      any
+	validate func(v any) string // returns a message when v is invalid
+}
+
+var prefSchema = []prefField{
+	{key: "default_nail_style", kind: prefString, def: "top_mounted", validate: maxLen(50)},
+	{key: "default_nail_diameter_mm", kind: prefNumber, def: 1.5, validate: between(0.1, 10)},
+	{key: "units", kind: prefString, def: "metric", validate: oneOf(string(units.Metric), string(units.Imperial))},
+	// "auto" follows the client's Accept-Language
+	{key: "locale", kind: prefString, def: "auto", validate: oneOf(append([]string{"auto"}, i18n.Supported()...)...)},
+	{key: "auto_save_progress", kind: prefBool, def: true},
+	{key: "haptic_feedback", kind: prefBool, def: false},
+	// Read directly by the notifications package, which treats a missing
+	// key as true; keep these defaulting to true
+	{key: "notify_export_ready", kind: prefBool, def: true},
+	{key: "notify_security", kind: prefBool, def: true},
+	// What GET /v1/profiles/{handle} shows. Profiles are private until the
+	// user opts in.
+	{key: "profile_public", kind: prefBool, def: false},
+	{key: "profile_show_projects", kind: prefBool, def: true},
+	{key: "profile_show_stats", kind: prefBool, def: true},
+}
+
+func prefFieldFor(key string) (prefField, bool) {
+	for _, f := range prefSchema {
+		if f.key == key {
+			return f, true
+		}
+	}
+	return prefField{}, false
+}
+
+// withDefaults fills in every key the user hasn't set. Stored values that
+// no longer pass validation, e.g. after a rule is tightened, fall back to
+// the default rather than leaking out.
+func withDefaults(stored map[string]any) Preferences {
+	p := Preferences{}
+	for _, f := range prefSchema {
+		p[f.key] = f.def
+		if v, ok := stored[f.key]; ok && f.check(v) == "" {
+			p[f.key] = v
+		}
+	}
+	return p
+}
+
+// validatePreferences checks a partial update. A null value is allowed and
+// resets that key to its default.
+func validatePreferences(updates map[string]any) map[string]string {
+	errs := map[string]string{}
+	for key, v := range updates {
+		f, ok := prefFieldFor(key)
+		if !ok {
+			errs["preferences."+key] = "unknown preference"
+			continue
+		}
+		if v == nil {
+			continue
+		}
+		if msg := f.check(v); msg != "" {
+			errs["preferences."+key] = msg
+		}
+	}
+	return errs
+}
+
+func (f prefField) check(v any) string {
+	switch f.kind {
+	case prefString:
+		if _, ok := v.(string); !ok {
+			return "must be a string"
+		}
+	case prefNumber:
+		if _, ok := v.(float64); !ok {
+			return "must be a number"
+		}
+	case prefBool:
+		if _, ok := v.(bool); !ok {
+			return "must be a boolean"
+		}
+	}
+	if f.validate != nil {
+		return f.validate(v)
+	}
+	return ""
+}
+
+func oneOf(allowed ...string) func(any) string {
+	return func(v any) string {
+		if !slices.Contains(allowed, v.(string)) {
+			return "must be one of " + strings.Join(allowed, ", ")
+		}
+		return ""
+	}
+}
+
+func between(lo, hi float64) func(any) string {
+	return func(v any) string {
+		if n := v.(float64); n < lo || n > hi {
+			return fmt.Sprintf("must be between %g and %g", lo, hi)
+		}
+		return ""
+	}
+}
+
+func maxLen(n int) func(any) string {
+	return func(v any) string {
+		s := v.(string)
+		if s == "" || len(s) > n {
+			return fmt.Sprintf("must be 1 to %d characters", n)
+		}
+		return ""
+	}
+}
+
+// Preferences returns the user's preferences without the rest of the user.
+func (s *Service) Preferences(ctx context.Context, id string) (Preferences, error) {
+	var stored map[string]any
+	err := s.db.QueryRow(ctx,
+		`SELECT preferences FROM users WHERE id = $1`, id).Scan(&stored)
+	if err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+	return withDefaults(stored), nil
+}
+
+// Locale returns the user's chosen locale, or "" if they follow the client's
+// language or can't be loaded.
+func (s *Service) Locale(ctx context.Context, id string) string {
+	prefs, err := s.Preferences(ctx, id)
+	if err != nil || prefs.String("locale") == "auto" {
+		return ""
+	}
+	return prefs.String("locale")
+}
+
+// UnitSystem returns the user's preferred units, defaulting to metric if
+// the user can't be loaded.
+func (s *Service) UnitSystem(ctx context.Context, id string) units.System {
+	prefs, err := s.Preferences(ctx, id)
+	if err != nil {
+		return units.Metric
+	}
+	return units.System(prefs.String("units"))
+}
@@ -0,0 +1,106 @@
+// internal/users/profile.go
+package users
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"stringmeup/backend/internal/imaging"
+)
+
+const (
+	maxBioLen      = 300
+	avatarSize     = 256
+	MaxAvatarBytes = 5 << 20
+	// Larger images are refused before decoding, since decoded size, not
+	// file size, is what costs memory
+	maxAvatarPixels = 40_000_000
+)
+
+var ErrInvalidImage = errors.New("avatar must be a JPEG or PNG image")
+
+var handleRe = regexp.MustCompile(`^[a-z0-9_]{3,30}$`)
+
+// reservedHandles could be mistaken for official accounts or app routes.
+var reservedHandles = []string{"admin", "api", "help", "me", "root", "settings", "support", "threadcraft"}
+
+// normalizeHandle lowercases h and returns a message if it can't be used.
+func normalizeHandle(h string) (string, string) {
+	h = strings.ToLower(strings.TrimSpace(h))
+	if !handleRe.MatchString(h) {
+		return h, "must be 3 to 30 letters, digits or underscores"
+	}
+	if slices.Contains(reservedHandles, h) {
+		return h, "is reserved"
+	}
+	return h, ""
+}
+
+// SetAvatar crops and resizes an uploaded image to a square JPEG and makes
+// it the user's avatar, deleting the previous one.
+func (s *Service) SetAvatar(ctx context.Context, id string, body io.Reader) (*User, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfg.Width*cfg.Height > maxAvatarPixels {
+		return nil, ErrInvalidImage
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	img = imaging.Orient(img, imaging.Orientation(data))
+
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, imaging.Square(img, avatarSize), &jpeg.Options{Quality: 85}); err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("users/%s/avatar/%s.jpg", id, uuid.New().String())
+	if err := s.uploads.Put(ctx, key, "image/jpeg", &out, int64(out.Len())); err != nil {
+		return nil, err
+	}
+
+	if err := s.replaceAvatar(ctx, id, key); err != nil {
+		return nil, err
+	}
+	return s.GetByID(ctx, id)
+}
+
+func (s *Service) DeleteAvatar(ctx context.Context, id string) error {
+	return s.replaceAvatar(ctx, id, "")
+}
+
+// replaceAvatar points the user at key and removes the old object. A
+// failed delete only leaves an orphan behind, so it isn't an error.
+func (s *Service) replaceAvatar(ctx context.Context, id, key string) error {
+	var old string
+	err := s.db.QueryRow(ctx,
+		`UPDATE users u SET avatar_key = $1
+		 FROM (SELECT avatar_key FROM users WHERE id = $2 FOR UPDATE) prev
+		 WHERE u.id = $2
+		 RETURNING prev.avatar_key`, key, id,
+	).Scan(&old)
+	if err != nil {
+		return fmt.Errorf("update avatar: %w", err)
+	}
+	if old != "" {
+		if err := s.uploads.Delete(ctx, old); err != nil {
+			log.Printf("users: delete old avatar %s: %v", old, err)
+		}
+	}
+	return nil
+}
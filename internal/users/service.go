@@ -4,78 +4,177 @@ package users
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+	"stringmeup/backend/internal/config"
+	"stringmeup/backend/internal/mail"
+	"stringmeup/backend/internal/notifications"
+	"stringmeup/backend/internal/uploads"
 )
 
-type Preferences struct {
-	DefaultNailStyle      string  `json:"default_nail_style"`
-	DefaultNailDiameterMM float64 `json:"default_nail_diameter_mm"`
-	Units                 string  `json:"units"`
-	AutoSaveProgress      bool    `json:"auto_save_progress"`
-	HapticFeedback        bool    `json:"haptic_feedback"`
-}
-
 type User struct {
 	ID          string      `json:"id"`
 	Email       string      `json:"email"`
 	Name        string      `json:"name"`
+	Handle      *string     `json:"handle"`
+	Bio         string      `json:"bio"`
+	AvatarURL   string      `json:"avatar_url"`
 	CreatedAt   time.Time   `json:"created_at"`
 	Preferences Preferences `json:"preferences"`
+	// Set while the account is waiting to be deleted
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+	// Only filled in for the user themselves, by GetMe
+	Storage *uploads.Usage `json:"storage,omitempty"`
 }
 
 type Service struct {
-	db *pgxpool.Pool
+	db      *pgxpool.Pool
+	cfg     *config.Config
+	uploads *uploads.Service
+	mailer  mail.Mailer
+	notify  *notifications.Service
 }
 
-func NewService(db *pgxpool.Pool) *Service { return &Service{db: db} }
+func NewService(db *pgxpool.Pool, cfg *config.Config, uploads *uploads.Service, mailer mail.Mailer,
+	notify *notifications.Service) *Service {
+	return &Service{db: db, cfg: cfg, uploads: uploads, mailer: mailer, notify: notify}
+}
+
+// GetMe returns the user with their storage usage.
+func (s *Service) GetMe(ctx context.Context, id string) (*User, error) {
+	u, err := s.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if u.Storage, err = s.uploads.Usage(ctx, id); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
 
 func (s *Service) GetByID(ctx context.Context, id string) (*User, error) {
 	u := &User{}
+	var stored map[string]any
+	var avatarKey string
 	err := s.db.QueryRow(ctx,
-		`SELECT id, email, name, created_at,
-		        COALESCE(pref_nail_style, 'top_mounted'),
-		        COALESCE(pref_nail_diameter_mm, 1.5),
-		        COALESCE(pref_units, 'metric'),
-		        COALESCE(pref_auto_save, true),
-		        COALESCE(pref_haptic, false)
+		`SELECT id, email, name, handle, bio, avatar_key, created_at, preferences, deletion_scheduled_at
 		 FROM users WHERE id = $1`, id,
-	).Scan(
-		&u.ID, &u.Email, &u.Name, &u.CreatedAt,
-		&u.Preferences.DefaultNailStyle,
-		&u.Preferences.DefaultNailDiameterMM,
-		&u.Preferences.Units,
-		&u.Preferences.AutoSaveProgress,
-		&u.Preferences.HapticFeedback,
-	)
+	).Scan(&u.ID, &u.Email, &u.Name, &u.Handle, &u.Bio, &avatarKey, &u.CreatedAt,
+		&stored, &u.DeletionScheduledAt)
 	if err != nil {
 		return nil, fmt.Errorf("user not found")
 	}
+	u.Preferences = withDefaults(stored)
+	if avatarKey != "" {
+		u.AvatarURL = s.uploads.URL(avatarKey)
+	}
 	return u, nil
 }
 
+// FieldErrors is returned by Update when the request fails validation,
+// keyed by the offending field's path.
+type FieldErrors map[string]string
+
+func (e FieldErrors) Error() string {
+	return fmt.Sprintf("%d invalid fields", len(e))
+}
+
+// Update applies a partial update of name, handle, bio and preferences. Everything is
+// validated first and then written in one transaction, so a bad field
+// leaves the user untouched.
 func (s *Service) Update(ctx context.Context, id string, updates map[string]any) (*User, error) {
-	// Apply known fields
-	if name, ok := updates["name"].(string); ok {
-		s.db.Exec(ctx, `UPDATE users SET name = $1 WHERE id = $2`, name, id)
+	errs := FieldErrors{}
+
+	var name *string
+	if v, ok := updates["name"]; ok {
+		if n, ok := v.(string); ok && strings.TrimSpace(n) != "" {
+			name = &n
+		} else {
+			errs["name"] = "must be a non-empty string"
+		}
 	}
-	if prefs, ok := updates["preferences"].(map[string]any); ok {
-		if v, ok := prefs["default_nail_style"].(string); ok {
-			s.db.Exec(ctx, `UPDATE users SET pref_nail_style = $1 WHERE id = $2`, v, id)
+
+	// A null handle unpublishes the profile's address
+	var handle *string
+	_, setHandle := updates["handle"]
+	if v, ok := updates["handle"].(string); ok {
+		h, msg := normalizeHandle(v)
+		if msg != "" {
+			errs["handle"] = msg
 		}
-		if v, ok := prefs["default_nail_diameter_mm"].(float64); ok {
-			s.db.Exec(ctx, `UPDATE users SET pref_nail_diameter_mm = $1 WHERE id = $2`, v, id)
+		handle = &h
+	} else if setHandle && updates["handle"] != nil {
+		errs["handle"] = "must be a string or null"
+	}
+
+	var bio *string
+	if v, ok := updates["bio"]; ok {
+		if b, ok := v.(string); ok && utf8.RuneCountInString(b) <= maxBioLen {
+			bio = &b
+		} else {
+			errs["bio"] = fmt.Sprintf("must be a string of at most %d characters", maxBioLen)
 		}
-		if v, ok := prefs["units"].(string); ok {
-			s.db.Exec(ctx, `UPDATE users SET pref_units = $1 WHERE id = $2`, v, id)
+	}
+
+	set := map[string]any{}
+	reset := []string{}
+	if v, ok := updates["preferences"]; ok {
+		prefs, ok := v.(map[string]any)
+		if !ok {
+			errs["preferences"] = "must be an object"
+		}
+		for field, msg := range validatePreferences(prefs) {
+			errs[field] = msg
 		}
-		if v, ok := prefs["auto_save_progress"].(bool); ok {
-			s.db.Exec(ctx, `UPDATE users SET pref_auto_save = $1 WHERE id = $2`, v, id)
+		for key, val := range prefs {
+			if val == nil {
+				reset = append(reset, key)
+			} else {
+				set[key] = val
+			}
 		}
-		if v, ok := prefs["haptic_feedback"].(bool); ok {
-			s.db.Exec(ctx, `UPDATE users SET pref_haptic = $1 WHERE id = $2`, v, id)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if name != nil {
+		if _, err := tx.Exec(ctx, `UPDATE users SET name = $1 WHERE id = $2`, *name, id); err != nil {
+			return nil, fmt.Errorf("update name: %w", err)
 		}
 	}
+	if setHandle {
+		_, err := tx.Exec(ctx, `UPDATE users SET handle = $1 WHERE id = $2`, handle, id)
+		if isUniqueViolation(err) {
+			return nil, FieldErrors{"handle": "is already taken"}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("update handle: %w", err)
+		}
+	}
+	if bio != nil {
+		if _, err := tx.Exec(ctx, `UPDATE users SET bio = $1 WHERE id = $2`, *bio, id); err != nil {
+			return nil, fmt.Errorf("update bio: %w", err)
+		}
+	}
+	if len(set) > 0 || len(reset) > 0 {
+		if _, err := tx.Exec(ctx,
+			`UPDATE users SET preferences = (preferences || $1::jsonb) - $2::text[] WHERE id = $3`,
+			set, reset, id); err != nil {
+			return nil, fmt.Errorf("update preferences: %w", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
 	return s.GetByID(ctx, id)
 }
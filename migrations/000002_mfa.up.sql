@@ -0,0 +1,27 @@
+-- migrations/000002_mfa.up.sql
+
+-- TOTP two-factor authentication
+ALTER TABLE users
+    ADD COLUMN totp_secret    TEXT,
+    ADD COLUMN totp_enabled   BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+-- Single-use recovery codes (SHA-256 hashed)
+CREATE TABLE mfa_recovery_codes (
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id    UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash  TEXT NOT NULL,
+    used_at    TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_mfa_recovery_codes_user_id ON mfa_recovery_codes(user_id);
+
+-- Pending logins waiting for a second factor
+CREATE TABLE mfa_challenges (
+    token      TEXT PRIMARY KEY,
+    user_id    UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    attempts   INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_mfa_challenges_user_id ON mfa_challenges(user_id);
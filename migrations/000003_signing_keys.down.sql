@@ -0,0 +1,2 @@
+-- migrations/000003_signing_keys.down.sql
+DROP TABLE IF EXISTS signing_keys;
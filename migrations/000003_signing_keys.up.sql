@@ -0,0 +1,12 @@
+-- migrations/000003_signing_keys.up.sql
+
+-- Ed25519 keys for signing access tokens. A key is published in the JWKS
+-- from created_at, signs from activates_at, and verifies until expires_at.
+CREATE TABLE signing_keys (
+    kid          TEXT PRIMARY KEY,
+    private_key  BYTEA NOT NULL,
+    public_key   BYTEA NOT NULL,
+    activates_at TIMESTAMPTZ NOT NULL,
+    expires_at   TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,3 @@
+-- migrations/000004_login_throttle.down.sql
+DROP TABLE IF EXISTS login_lockouts;
+DROP TABLE IF EXISTS login_attempts;
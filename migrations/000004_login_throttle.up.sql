@@ -0,0 +1,27 @@
+-- migrations/000004_login_throttle.up.sql
+
+-- Every password attempt, successful or not. Keyed by the submitted email
+-- rather than user_id so unknown addresses are throttled the same way.
+CREATE TABLE login_attempts (
+    id         BIGSERIAL PRIMARY KEY,
+    email      TEXT NOT NULL,
+    ip         TEXT NOT NULL,
+    succeeded  BOOLEAN NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_login_attempts_email ON login_attempts(email, created_at);
+CREATE INDEX idx_login_attempts_ip ON login_attempts(ip, created_at);
+
+-- Lockout events, kept so support can see and lift them
+CREATE TABLE login_lockouts (
+    id           UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    email        TEXT,
+    ip           TEXT,
+    failures     INTEGER NOT NULL,
+    locked_until TIMESTAMPTZ NOT NULL,
+    unlocked_at  TIMESTAMPTZ,
+    unlocked_by  TEXT,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_login_lockouts_email ON login_lockouts(email, created_at);
+CREATE INDEX idx_login_lockouts_ip ON login_lockouts(ip, created_at);
@@ -0,0 +1,2 @@
+-- migrations/000005_personal_access_tokens.down.sql
+DROP TABLE IF EXISTS personal_access_tokens;
@@ -0,0 +1,16 @@
+-- migrations/000005_personal_access_tokens.up.sql
+
+-- Long-lived scoped tokens for scripts and machines (SHA-256 hashed)
+CREATE TABLE personal_access_tokens (
+    id           UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id      UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name         TEXT NOT NULL,
+    token_hash   TEXT NOT NULL UNIQUE,
+    token_hint   TEXT NOT NULL,
+    scopes       TEXT[] NOT NULL,
+    expires_at   TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    revoked_at   TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_personal_access_tokens_user_id ON personal_access_tokens(user_id);
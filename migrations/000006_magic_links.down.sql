@@ -0,0 +1,2 @@
+-- migrations/000006_magic_links.down.sql
+DROP TABLE IF EXISTS magic_links;
@@ -0,0 +1,15 @@
+-- migrations/000006_magic_links.up.sql
+
+-- Single-use passwordless login links. Each carries a link token for
+-- clicking and a short code for typing; both are stored hashed.
+CREATE TABLE magic_links (
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id    UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    code_hash  TEXT NOT NULL,
+    attempts   INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at    TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_magic_links_user_id ON magic_links(user_id, created_at);
@@ -0,0 +1,3 @@
+-- migrations/000007_account_deletion.down.sql
+DROP INDEX IF EXISTS idx_users_deletion_scheduled_at;
+ALTER TABLE users DROP COLUMN IF EXISTS deletion_scheduled_at;
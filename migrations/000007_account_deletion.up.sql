@@ -0,0 +1,7 @@
+-- migrations/000007_account_deletion.up.sql
+
+-- Set when the user asks to delete their account; cleared if they log in
+-- again before it passes.
+ALTER TABLE users ADD COLUMN deletion_scheduled_at TIMESTAMPTZ;
+CREATE INDEX idx_users_deletion_scheduled_at ON users(deletion_scheduled_at)
+    WHERE deletion_scheduled_at IS NOT NULL;
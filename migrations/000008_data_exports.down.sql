@@ -0,0 +1,2 @@
+-- migrations/000008_data_exports.down.sql
+DROP TABLE IF EXISTS data_exports;
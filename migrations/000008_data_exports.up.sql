@@ -0,0 +1,17 @@
+-- migrations/000008_data_exports.up.sql
+
+-- Personal data export archives, built in the background
+CREATE TABLE data_exports (
+    id           UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id      UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status       TEXT NOT NULL DEFAULT 'pending', -- pending | processing | ready | failed | expired
+    object_key   TEXT NOT NULL DEFAULT '',
+    size_bytes   BIGINT NOT NULL DEFAULT 0,
+    error        TEXT NOT NULL DEFAULT '',
+    started_at   TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+    expires_at   TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_data_exports_user_id ON data_exports(user_id, created_at);
+CREATE INDEX idx_data_exports_status ON data_exports(status);
@@ -0,0 +1,2 @@
+-- migrations/000009_email_changes.down.sql
+DROP TABLE IF EXISTS email_changes;
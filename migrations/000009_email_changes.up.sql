@@ -0,0 +1,11 @@
+-- migrations/000009_email_changes.up.sql
+
+-- Pending email changes, applied once the new address is confirmed
+CREATE TABLE email_changes (
+    token_hash TEXT PRIMARY KEY,
+    user_id    UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    new_email  TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_email_changes_user_id ON email_changes(user_id);
@@ -0,0 +1,16 @@
+-- migrations/000010_preferences_jsonb.down.sql
+ALTER TABLE users
+    ADD COLUMN pref_nail_style       TEXT DEFAULT 'top_mounted',
+    ADD COLUMN pref_nail_diameter_mm NUMERIC(4,2) DEFAULT 1.5,
+    ADD COLUMN pref_units            TEXT DEFAULT 'metric',
+    ADD COLUMN pref_auto_save        BOOLEAN DEFAULT TRUE,
+    ADD COLUMN pref_haptic           BOOLEAN DEFAULT FALSE;
+
+UPDATE users SET
+    pref_nail_style       = COALESCE(preferences->>'default_nail_style', 'top_mounted'),
+    pref_nail_diameter_mm = COALESCE((preferences->>'default_nail_diameter_mm')::NUMERIC, 1.5),
+    pref_units            = COALESCE(preferences->>'units', 'metric'),
+    pref_auto_save        = COALESCE((preferences->>'auto_save_progress')::BOOLEAN, TRUE),
+    pref_haptic           = COALESCE((preferences->>'haptic_feedback')::BOOLEAN, FALSE);
+
+ALTER TABLE users DROP COLUMN preferences;
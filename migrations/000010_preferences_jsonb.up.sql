@@ -0,0 +1,20 @@
+-- migrations/000010_preferences_jsonb.up.sql
+
+-- Preferences move from one column per key to a JSONB document. Only keys
+-- the user has set are stored; defaults live in the Go schema.
+ALTER TABLE users ADD COLUMN preferences JSONB NOT NULL DEFAULT '{}';
+
+UPDATE users SET preferences = jsonb_strip_nulls(jsonb_build_object(
+    'default_nail_style',       pref_nail_style,
+    'default_nail_diameter_mm', pref_nail_diameter_mm,
+    'units',                    pref_units,
+    'auto_save_progress',       pref_auto_save,
+    'haptic_feedback',          pref_haptic
+));
+
+ALTER TABLE users
+    DROP COLUMN pref_nail_style,
+    DROP COLUMN pref_nail_diameter_mm,
+    DROP COLUMN pref_units,
+    DROP COLUMN pref_auto_save,
+    DROP COLUMN pref_haptic;
@@ -0,0 +1,6 @@
+-- migrations/000011_admin.down.sql
+DROP TABLE IF EXISTS admin_audit_log;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS sessions_revoked_at,
+    DROP COLUMN IF EXISTS disabled_at,
+    DROP COLUMN IF EXISTS role;
@@ -0,0 +1,19 @@
+-- migrations/000011_admin.up.sql
+
+ALTER TABLE users
+    ADD COLUMN role                TEXT NOT NULL DEFAULT 'user', -- user | admin
+    ADD COLUMN disabled_at         TIMESTAMPTZ,
+    ADD COLUMN sessions_revoked_at TIMESTAMPTZ; -- access tokens issued before this are rejected
+
+-- Every action taken through /v1/admin. target_user_id has no foreign key
+-- so the trail survives account deletion.
+CREATE TABLE admin_audit_log (
+    id             UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    admin_id       UUID REFERENCES users(id) ON DELETE SET NULL,
+    action         TEXT NOT NULL,
+    target_user_id UUID,
+    details        JSONB NOT NULL DEFAULT '{}',
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_admin_audit_log_created_at ON admin_audit_log(created_at);
+CREATE INDEX idx_admin_audit_log_target_user_id ON admin_audit_log(target_user_id);
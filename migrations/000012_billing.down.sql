@@ -0,0 +1,3 @@
+-- migrations/000012_billing.down.sql
+DROP TABLE IF EXISTS billing_events;
+DROP TABLE IF EXISTS subscriptions;
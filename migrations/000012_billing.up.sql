@@ -0,0 +1,23 @@
+-- migrations/000012_billing.up.sql
+
+-- One subscription per user. Users without a row are on the free plan.
+CREATE TABLE subscriptions (
+    user_id            UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    provider           TEXT NOT NULL,
+    customer_id        TEXT NOT NULL DEFAULT '',
+    subscription_id    TEXT NOT NULL,
+    plan               TEXT NOT NULL,            -- free | pro
+    status             TEXT NOT NULL,            -- active | trialing | past_due | canceled
+    current_period_end TIMESTAMPTZ,
+    updated_at         TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (provider, subscription_id)
+);
+
+-- Webhook events already applied, so redelivered events are ignored
+CREATE TABLE billing_events (
+    provider    TEXT NOT NULL,
+    event_id    TEXT NOT NULL,
+    type        TEXT NOT NULL,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (provider, event_id)
+);
@@ -0,0 +1,2 @@
+-- migrations/000013_notifications.down.sql
+DROP TABLE IF EXISTS notifications;
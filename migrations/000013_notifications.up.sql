@@ -0,0 +1,15 @@
+-- migrations/000013_notifications.up.sql
+
+CREATE TABLE notifications (
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id    UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind       TEXT NOT NULL, -- export_ready | security
+    title      TEXT NOT NULL,
+    body       TEXT NOT NULL DEFAULT '',
+    data       JSONB NOT NULL DEFAULT '{}',
+    read_at    TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+-- Serves both the newest-first listing and its cursor
+CREATE INDEX idx_notifications_user_id ON notifications(user_id, created_at DESC, id DESC);
+CREATE INDEX idx_notifications_unread ON notifications(user_id) WHERE read_at IS NULL;
@@ -0,0 +1,2 @@
+-- migrations/000014_export_locale.down.sql
+ALTER TABLE data_exports DROP COLUMN IF EXISTS locale;
@@ -0,0 +1,5 @@
+-- migrations/000014_export_locale.up.sql
+
+-- Locale of the request that queued the export, for the email sent when
+-- it is ready
+ALTER TABLE data_exports ADD COLUMN locale TEXT NOT NULL DEFAULT 'en';
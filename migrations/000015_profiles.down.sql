@@ -0,0 +1,7 @@
+-- migrations/000015_profiles.down.sql
+ALTER TABLE projects DROP COLUMN IF EXISTS published_at;
+DROP INDEX IF EXISTS idx_users_handle;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS handle,
+    DROP COLUMN IF EXISTS bio,
+    DROP COLUMN IF EXISTS avatar_key;
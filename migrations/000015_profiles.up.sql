@@ -0,0 +1,13 @@
+-- migrations/000015_profiles.up.sql
+
+ALTER TABLE users
+    ADD COLUMN handle     TEXT,
+    ADD COLUMN bio        TEXT NOT NULL DEFAULT '',
+    ADD COLUMN avatar_key TEXT NOT NULL DEFAULT '';
+-- Handles are stored lowercase; the index keeps them unique and serves
+-- profile lookups
+CREATE UNIQUE INDEX idx_users_handle ON users(handle) WHERE handle IS NOT NULL;
+
+-- Published projects appear on the owner's public profile
+ALTER TABLE projects ADD COLUMN published_at TIMESTAMPTZ;
+CREATE INDEX idx_projects_published ON projects(user_id, published_at) WHERE published_at IS NOT NULL;
@@ -0,0 +1,3 @@
+-- migrations/000016_uploads.down.sql
+ALTER TABLE projects DROP COLUMN IF EXISTS image_upload_id;
+DROP TABLE IF EXISTS uploads;
@@ -0,0 +1,22 @@
+-- migrations/000016_uploads.up.sql
+
+-- Every presigned upload. Rows start pending and become complete once the
+-- client reports the object uploaded and it passes verification.
+CREATE TABLE uploads (
+    id           UUID PRIMARY KEY,
+    user_id      UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    object_key   TEXT NOT NULL UNIQUE,
+    content_type TEXT NOT NULL,
+    status       TEXT NOT NULL DEFAULT 'pending', -- pending | complete | rejected
+    size_bytes   BIGINT NOT NULL DEFAULT 0,
+    width        INTEGER,
+    height       INTEGER,
+    sha256       TEXT NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMPTZ
+);
+CREATE INDEX idx_uploads_user_id ON uploads(user_id, created_at);
+
+-- image_remote_url is now derived from the upload and kept for clients
+-- that read it. Projects created before this keep their URL and no upload.
+ALTER TABLE projects ADD COLUMN image_upload_id UUID REFERENCES uploads(id) ON DELETE SET NULL;
@@ -0,0 +1,5 @@
+-- migrations/000017_image_derivatives.down.sql
+DROP INDEX IF EXISTS idx_uploads_processing;
+ALTER TABLE uploads
+    DROP COLUMN IF EXISTS processing_started_at,
+    DROP COLUMN IF EXISTS processing;
@@ -0,0 +1,9 @@
+-- migrations/000017_image_derivatives.up.sql
+
+-- Completed uploads are queued for thumbnails and working copies. Uploads
+-- completed before this are processed too.
+ALTER TABLE uploads
+    ADD COLUMN processing            TEXT NOT NULL DEFAULT 'pending', -- pending | processing | ready | failed | unsupported
+    ADD COLUMN processing_started_at TIMESTAMPTZ;
+CREATE INDEX idx_uploads_processing ON uploads(completed_at)
+    WHERE status = 'complete' AND processing IN ('pending', 'processing');
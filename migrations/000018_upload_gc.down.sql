@@ -0,0 +1,2 @@
+-- migrations/000018_upload_gc.down.sql
+DROP TABLE IF EXISTS upload_gc_runs;
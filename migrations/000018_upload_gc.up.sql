@@ -0,0 +1,18 @@
+-- migrations/000018_upload_gc.up.sql
+
+-- One row per garbage collection of unreferenced images. Uploads whose
+-- object is collected get status 'deleted'.
+CREATE TABLE upload_gc_runs (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    dry_run         BOOLEAN NOT NULL,
+    objects_scanned INTEGER NOT NULL DEFAULT 0,
+    bytes_scanned   BIGINT NOT NULL DEFAULT 0,
+    orphans         INTEGER NOT NULL DEFAULT 0,
+    orphan_bytes    BIGINT NOT NULL DEFAULT 0,
+    deleted         INTEGER NOT NULL DEFAULT 0,
+    reclaimed_bytes BIGINT NOT NULL DEFAULT 0, -- includes derivatives
+    error           TEXT NOT NULL DEFAULT '',
+    started_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at     TIMESTAMPTZ
+);
+CREATE INDEX idx_upload_gc_runs_started_at ON upload_gc_runs(started_at);
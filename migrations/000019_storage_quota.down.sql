@@ -0,0 +1,3 @@
+-- migrations/000019_storage_quota.down.sql
+ALTER TABLE users DROP COLUMN IF EXISTS storage_bytes;
+ALTER TABLE uploads DROP COLUMN IF EXISTS derived_bytes;
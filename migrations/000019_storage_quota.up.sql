@@ -0,0 +1,11 @@
+-- migrations/000019_storage_quota.up.sql
+
+-- users.storage_bytes caches the total of the user's complete uploads and
+-- their derivatives. It is kept up to date as uploads change and can be
+-- recomputed from storage by an admin.
+ALTER TABLE uploads ADD COLUMN derived_bytes BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN storage_bytes BIGINT NOT NULL DEFAULT 0;
+
+-- Derivatives made before this aren't counted until a recompute
+UPDATE users u SET storage_bytes = COALESCE(
+    (SELECT SUM(size_bytes) FROM uploads WHERE user_id = u.id AND status = 'complete'), 0);
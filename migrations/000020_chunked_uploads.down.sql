@@ -0,0 +1,4 @@
+-- migrations/000020_chunked_uploads.down.sql
+ALTER TABLE uploads
+    DROP COLUMN IF EXISTS received_bytes,
+    DROP COLUMN IF EXISTS total_bytes;
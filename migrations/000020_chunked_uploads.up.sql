@@ -0,0 +1,7 @@
+-- migrations/000020_chunked_uploads.up.sql
+
+-- Chunked uploads declare their size up front and count the bytes received
+-- so far, which is the offset the client resumes from.
+ALTER TABLE uploads
+    ADD COLUMN total_bytes    BIGINT,
+    ADD COLUMN received_bytes BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+-- migrations/000021_image_adjustments.down.sql
+ALTER TABLE projects
+    DROP COLUMN IF EXISTS working_image_key,
+    DROP COLUMN IF EXISTS image_adjustments;
@@ -0,0 +1,8 @@
+-- migrations/000021_image_adjustments.up.sql
+
+-- The crop, rotation and tone a project applies to its image, and the
+-- working copy rendered with them. An empty key means the upload's plain
+-- working copy is used.
+ALTER TABLE projects
+    ADD COLUMN image_adjustments JSONB,
+    ADD COLUMN working_image_key TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+-- migrations/000022_upload_dedup.down.sql
+DROP INDEX IF EXISTS idx_uploads_user_sha256;
+ALTER TABLE uploads
+    DROP COLUMN IF EXISTS ref_count,
+    DROP COLUMN IF EXISTS duplicate_of;
@@ -0,0 +1,12 @@
+-- migrations/000022_upload_dedup.up.sql
+
+-- An upload completed with content the user already has becomes a
+-- duplicate of the earlier one, which keeps the only stored copy and its
+-- derivatives. status gains 'duplicate'.
+ALTER TABLE uploads
+    ADD COLUMN duplicate_of UUID REFERENCES uploads(id),
+    ADD COLUMN ref_count    INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX idx_uploads_user_sha256 ON uploads(user_id, sha256) WHERE status = 'complete';
+
+-- ref_count is the number of projects using the upload
+UPDATE uploads u SET ref_count = (SELECT COUNT(*) FROM projects p WHERE p.image_upload_id = u.id);
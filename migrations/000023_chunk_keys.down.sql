@@ -0,0 +1,2 @@
+-- migrations/000023_chunk_keys.down.sql
+ALTER TABLE uploads DROP COLUMN IF EXISTS chunk_keys;
@@ -0,0 +1,6 @@
+-- migrations/000023_chunk_keys.up.sql
+
+-- Each attempt at a chunk is stored under its own key. Only the attempt
+-- that claimed the chunk's offset is recorded here, in upload order, so a
+-- retry racing it can never replace the bytes that were counted.
+ALTER TABLE uploads ADD COLUMN chunk_keys TEXT[] NOT NULL DEFAULT '{}';
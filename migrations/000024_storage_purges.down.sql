@@ -0,0 +1,2 @@
+-- migrations/000024_storage_purges.down.sql
+DROP TABLE IF EXISTS storage_purges;
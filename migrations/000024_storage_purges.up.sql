@@ -0,0 +1,11 @@
+-- migrations/000024_storage_purges.up.sql
+
+-- Deleted accounts whose stored objects still have to be removed. A row is
+-- added in the same transaction that deletes the user and dropped once the
+-- user's whole storage prefix is gone, so a storage outage only delays the
+-- cleanup.
+CREATE TABLE storage_purges (
+    user_id    UUID PRIMARY KEY,
+    attempts   INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
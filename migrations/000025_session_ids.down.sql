@@ -0,0 +1,3 @@
+-- migrations/000025_session_ids.down.sql
+ALTER TABLE users DROP COLUMN IF EXISTS sessions_kept_id;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS session_id;
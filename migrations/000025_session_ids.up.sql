@@ -0,0 +1,7 @@
+-- migrations/000025_session_ids.up.sql
+
+-- A session is a login and every refresh after it. Its ID is in each
+-- access token's jti and on its refresh token, so one session can survive
+-- revoking the rest: sessions_kept_id is exempt from sessions_revoked_at.
+ALTER TABLE refresh_tokens ADD COLUMN session_id UUID;
+ALTER TABLE users ADD COLUMN sessions_kept_id UUID;
@@ -0,0 +1,3 @@
+-- migrations/000026_notification_messages.down.sql
+ALTER TABLE notifications DROP COLUMN IF EXISTS args;
+ALTER TABLE notifications DROP COLUMN IF EXISTS message_key;
@@ -0,0 +1,7 @@
+-- migrations/000026_notification_messages.up.sql
+
+-- Notifications are translated when read: message_key names the i18n
+-- messages (with .title and .body appended) and args fills them in.
+-- title and body keep the default-locale text, which is all older rows have.
+ALTER TABLE notifications ADD COLUMN message_key TEXT;
+ALTER TABLE notifications ADD COLUMN args JSONB NOT NULL DEFAULT '[]';